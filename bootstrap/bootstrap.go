@@ -0,0 +1,309 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/devopsext/sre/common"
+	"github.com/devopsext/sre/provider"
+	"github.com/devopsext/utils"
+)
+
+type Options struct {
+	ServiceName string
+	Environment string
+	Version     string
+
+	Logs             []string
+	Metrics          []string
+	MetricsMaxSeries int
+	Traces           []string
+	Events           []string
+
+	Stdout     provider.StdoutOptions
+	Redactor   common.RedactorOptions
+	Sampler    common.SamplerOptions
+	Tail       common.TailSamplerOptions
+	Prometheus provider.PrometheusOptions
+	Statsd     provider.StatsdOptions
+	InfluxDB   provider.InfluxDBOptions
+	Graphite   provider.GraphiteOptions
+	Jaeger     provider.JaegerOptions
+
+	DataDog        provider.DataDogOptions
+	DataDogLogger  provider.DataDogLoggerOptions
+	DataDogTracer  provider.DataDogTracerOptions
+	DataDogMeter   provider.DataDogMeterOptions
+	DataDogEventer provider.DataDogEventerOptions
+
+	NewRelic        provider.NewRelicOptions
+	NewRelicLogger  provider.NewRelicLoggerOptions
+	NewRelicTracer  provider.NewRelicTracerOptions
+	NewRelicMeter   provider.NewRelicMeterOptions
+	NewRelicEventer provider.NewRelicEventerOptions
+
+	Grafana        provider.GrafanaOptions
+	GrafanaEventer provider.GrafanaEventerOptions
+}
+
+type Bootstrap struct {
+	Stdout  *provider.Stdout
+	Logs    *common.Logs
+	Traces  *common.Traces
+	Metrics *common.Metrics
+	Events  *common.Events
+
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func setIdentity(serviceName, environment, version *string, options Options) {
+
+	if utils.IsEmpty(*serviceName) {
+		*serviceName = options.ServiceName
+	}
+	if utils.IsEmpty(*environment) {
+		*environment = options.Environment
+	}
+	if utils.IsEmpty(*version) {
+		*version = options.Version
+	}
+}
+
+// prepareOptions fills empty service name, environment and version of every provider by shared ones,
+// and copies vendor options into their logger, tracer, meter and eventer options
+func prepareOptions(options Options) Options {
+
+	if utils.IsEmpty(options.Stdout.Version) {
+		options.Stdout.Version = options.Version
+	}
+	if utils.IsEmpty(options.Grafana.Version) {
+		options.Grafana.Version = options.Version
+	}
+	if utils.IsEmpty(options.Jaeger.Version) {
+		options.Jaeger.Version = options.Version
+	}
+	if utils.IsEmpty(options.Jaeger.ServiceName) {
+		options.Jaeger.ServiceName = options.ServiceName
+	}
+
+	setIdentity(&options.Prometheus.ServiceName, &options.Prometheus.Environment, &options.Prometheus.Version, options)
+	setIdentity(&options.DataDog.ServiceName, &options.DataDog.Environment, &options.DataDog.Version, options)
+	setIdentity(&options.NewRelic.ServiceName, &options.NewRelic.Environment, &options.NewRelic.Version, options)
+
+	options.DataDogLogger.DataDogOptions = options.DataDog
+	options.DataDogTracer.DataDogOptions = options.DataDog
+	options.DataDogMeter.DataDogOptions = options.DataDog
+	options.DataDogEventer.DataDogOptions = options.DataDog
+
+	options.NewRelicLogger.NewRelicOptions = options.NewRelic
+	options.NewRelicTracer.NewRelicOptions = options.NewRelic
+	options.NewRelicMeter.NewRelicOptions = options.NewRelic
+	options.NewRelicEventer.NewRelicOptions = options.NewRelic
+
+	options.GrafanaEventer.GrafanaOptions = options.Grafana
+	return options
+}
+
+// New creates providers enabled in options and registers them in logs, traces, metrics and events
+func New(options Options) (*Bootstrap, error) {
+
+	options = prepareOptions(options)
+
+	b := &Bootstrap{
+		Logs:    common.NewLogs(),
+		Traces:  common.NewTraces(),
+		Metrics: common.NewMetrics(),
+		Events:  common.NewEvents(),
+	}
+
+	// Logs
+
+	b.Stdout = provider.NewStdout(options.Stdout)
+	b.Stdout.SetCallerOffset(2)
+	if utils.Contains(options.Logs, "stdout") {
+		b.Logs.Register(b.Stdout)
+	}
+
+	redactor, err := common.NewRedactor(options.Redactor)
+	if err != nil {
+		b.Logs.Error(err)
+		b.Logs.Stop()
+		return nil, err
+	}
+	if len(options.Redactor.Detectors) > 0 || len(options.Redactor.Patterns) > 0 || len(options.Redactor.Fields) > 0 {
+		b.Logs.SetRedactor(redactor)
+		b.Traces.SetRedactor(redactor)
+	}
+
+	sampler, err := common.NewSampler(options.Sampler)
+	if err != nil {
+		b.Logs.Error(err)
+		b.Logs.Stop()
+		return nil, err
+	}
+	if !utils.IsEmpty(options.Sampler.Type) || len(options.Sampler.Operations) > 0 {
+		b.Traces.SetSampler(sampler)
+	}
+
+	// tail sampler is enabled by window
+	if options.Tail.Window > 0 {
+		tail, err := common.NewTailSampler(options.Tail)
+		if err != nil {
+			b.Logs.Error(err)
+			b.Logs.Stop()
+			return nil, err
+		}
+		b.Traces.SetTailSampler(tail)
+	}
+
+	if utils.Contains(options.Logs, "datadog") {
+		datadogLogger := provider.NewDataDogLogger(options.DataDogLogger, b.Logs, b.Stdout)
+		if datadogLogger != nil {
+			b.Logs.Register(datadogLogger)
+		}
+	}
+
+	if utils.Contains(options.Logs, "newrelic") {
+		newrelicLogger := provider.NewNewRelicLogger(options.NewRelicLogger, b.Logs, b.Stdout)
+		if newrelicLogger != nil {
+			b.Logs.Register(newrelicLogger)
+		}
+	}
+
+	// Metrics
+
+	b.Metrics.SetMaxSeries(options.MetricsMaxSeries)
+	b.Metrics.SetLogger(b.Logs)
+
+	if utils.Contains(options.Metrics, "prometheus") {
+		prometheus := provider.NewPrometheusMeter(options.Prometheus, b.Logs, b.Stdout)
+		if prometheus != nil {
+			prometheus.StartInWaitGroup(&b.wg)
+			b.Metrics.Register(prometheus)
+		}
+	}
+
+	if utils.Contains(options.Metrics, "datadog") {
+		datadogMeter := provider.NewDataDogMeter(options.DataDogMeter, b.Logs, b.Stdout)
+		if datadogMeter != nil {
+			b.Metrics.Register(datadogMeter)
+		}
+	}
+
+	if utils.Contains(options.Metrics, "statsd") {
+		statsdMeter := provider.NewStatsdMeter(options.Statsd, b.Logs, b.Stdout)
+		if statsdMeter != nil {
+			b.Metrics.Register(statsdMeter)
+		}
+	}
+
+	if utils.Contains(options.Metrics, "influxdb") {
+		influxdbMeter := provider.NewInfluxDBMeter(options.InfluxDB, b.Logs, b.Stdout)
+		if influxdbMeter != nil {
+			b.Metrics.Register(influxdbMeter)
+		}
+	}
+
+	if utils.Contains(options.Metrics, "graphite") {
+		graphiteMeter := provider.NewGraphiteMeter(options.Graphite, b.Logs, b.Stdout)
+		if graphiteMeter != nil {
+			b.Metrics.Register(graphiteMeter)
+		}
+	}
+
+	if utils.Contains(options.Metrics, "newrelic") {
+		newrelicMeter := provider.NewNewRelicMeter(options.NewRelicMeter, b.Logs, b.Stdout)
+		if newrelicMeter != nil {
+			b.Metrics.Register(newrelicMeter)
+		}
+	}
+
+	common.SetTelemetry(common.NewTelemetry(b.Metrics))
+
+	// Traces
+
+	if utils.Contains(options.Traces, "jaeger") {
+		jaeger := provider.NewJaegerTracer(options.Jaeger, b.Logs, b.Stdout)
+		if jaeger != nil {
+			b.Traces.Register(jaeger)
+		}
+	}
+
+	if utils.Contains(options.Traces, "datadog") {
+		datadogTracer := provider.NewDataDogTracer(options.DataDogTracer, b.Logs, b.Stdout)
+		if datadogTracer != nil {
+			b.Traces.Register(datadogTracer)
+		}
+	}
+
+	if utils.Contains(options.Traces, "newrelic") {
+		newrelicTracer := provider.NewNewRelicTracer(options.NewRelicTracer, b.Logs, b.Stdout)
+		if newrelicTracer != nil {
+			b.Traces.Register(newrelicTracer)
+		}
+	}
+
+	// Events
+
+	if utils.Contains(options.Events, "grafana") {
+		grafanaEventer := provider.NewGrafanaEventer(options.GrafanaEventer, b.Logs, b.Stdout)
+		if grafanaEventer != nil {
+			b.Events.Register(grafanaEventer)
+		}
+	}
+
+	if utils.Contains(options.Events, "newrelic") {
+		newrelicEventer := provider.NewNewRelicEventer(options.NewRelicEventer, b.Logs, b.Stdout)
+		if newrelicEventer != nil {
+			b.Events.Register(newrelicEventer)
+		}
+	}
+
+	if utils.Contains(options.Events, "datadog") {
+		datadogEventer := provider.NewDataDogEventer(options.DataDogEventer, b.Logs, b.Stdout)
+		if datadogEventer != nil {
+			b.Events.Register(datadogEventer)
+		}
+	}
+
+	return b, nil
+}
+
+// Wait blocks until prometheus endpoint is stopped
+func (b *Bootstrap) Wait() {
+	b.wg.Wait()
+}
+
+// Flush asks providers to send what they have buffered without stopping them,
+// for instance at the end of serverless invocation
+func (b *Bootstrap) Flush(ctx context.Context) error {
+	return errors.Join(b.Traces.Flush(ctx), b.Metrics.Flush(ctx), b.Events.Flush(ctx), b.Logs.Flush(ctx))
+}
+
+// Shutdown stops traces, metrics, events and then logs once, so errors of others can still be logged,
+// ctx limits time to deliver what providers have buffered
+func (b *Bootstrap) Shutdown(ctx context.Context) error {
+
+	var err error
+	b.once.Do(func() {
+
+		err = errors.Join(b.Traces.Shutdown(ctx), b.Metrics.Shutdown(ctx), b.Events.Shutdown(ctx))
+		if err != nil {
+			b.Logs.Error(err)
+		}
+
+		lerr := b.Logs.Shutdown(ctx)
+		if lerr != nil {
+			b.Stdout.Error(lerr)
+		}
+		err = errors.Join(err, lerr)
+	})
+	return err
+}
+
+// Stop shuts providers down without deadline
+func (b *Bootstrap) Stop() {
+	b.Shutdown(context.Background())
+}
@@ -0,0 +1,165 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	"github.com/devopsext/sre/provider"
+	"github.com/opentracing/opentracing-go"
+)
+
+type bootstrapTestEventer struct {
+	*provider.MemoryEventer
+}
+
+func (e *bootstrapTestEventer) Shutdown(ctx context.Context) error {
+	return errors.New("events are not delivered")
+}
+
+func TestBootstrapOptions(t *testing.T) {
+
+	options := prepareOptions(Options{
+		ServiceName: "service",
+		Environment: "prod",
+		Version:     "1.0",
+		Jaeger:      provider.JaegerOptions{ServiceName: "jaeger"},
+		DataDog:     provider.DataDogOptions{ApiKey: "key"},
+		NewRelic:    provider.NewRelicOptions{Environment: "stage"},
+		Grafana:     provider.GrafanaOptions{URL: "http://grafana"},
+	})
+
+	if options.Jaeger.ServiceName != "jaeger" || options.Jaeger.Version != "1.0" {
+		t.Fatalf("Wrong jaeger options: %v", options.Jaeger)
+	}
+	if options.Prometheus.ServiceName != "service" || options.Prometheus.Environment != "prod" {
+		t.Fatalf("Wrong prometheus options: %v", options.Prometheus)
+	}
+
+	dd := options.DataDogTracer.DataDogOptions
+	if dd.ApiKey != "key" || dd.ServiceName != "service" || dd.Environment != "prod" || dd.Version != "1.0" {
+		t.Fatalf("Wrong datadog tracer options: %v", dd)
+	}
+
+	nr := options.NewRelicEventer.NewRelicOptions
+	if nr.ServiceName != "service" || nr.Environment != "stage" {
+		t.Fatalf("Wrong newrelic eventer options: %v", nr)
+	}
+	if options.GrafanaEventer.URL != "http://grafana" || options.GrafanaEventer.Version != "1.0" {
+		t.Fatalf("Wrong grafana eventer options: %v", options.GrafanaEventer)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	b, err := New(Options{
+		ServiceName: "service",
+		Logs:        []string{"stdout"},
+		Metrics:     []string{"statsd"},
+		Stdout:      provider.StdoutOptions{Format: "template", Level: "info", Template: "{{.msg}}"},
+		Statsd: provider.StatsdOptions{
+			Host:          "127.0.0.1",
+			Port:          conn.LocalAddr().(*net.UDPAddr).Port,
+			FlushInterval: time.Hour,
+			SampleRate:    1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetTelemetry(nil)
+
+	if b.Stdout == nil || b.Logs == nil || b.Traces == nil || b.Metrics == nil || b.Events == nil {
+		t.Fatal("Providers are not created")
+	}
+
+	logger := provider.NewMemoryLogger()
+	b.Logs.Register(logger)
+	b.Events.Register(&bootstrapTestEventer{MemoryEventer: provider.NewMemoryEventer()})
+
+	b.Metrics.Counter("", "requests", "Requests", nil).Inc()
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf[:n]), "requests:1|c") {
+		t.Fatalf("Counter is not flushed: %s", buf[:n])
+	}
+
+	if err := b.Shutdown(context.Background()); err == nil || !strings.Contains(err.Error(), "not delivered") {
+		t.Fatalf("Eventer error is not reported: %v", err)
+	}
+	if len(logger.Find("error", "not delivered")) != 1 {
+		t.Fatal("Eventer error is not logged before logs are stopped")
+	}
+	b.Stop()
+	b.Wait()
+}
+
+func TestBootstrapRedactor(t *testing.T) {
+
+	_, err := New(Options{
+		Redactor: common.RedactorOptions{Detectors: []string{"unknown"}},
+	})
+	if err == nil {
+		t.Fatal("Unknown redactor detector is accepted")
+	}
+}
+
+func TestBootstrapSampler(t *testing.T) {
+
+	_, err := New(Options{
+		Sampler: common.SamplerOptions{Type: common.SamplerTypeProbabilistic, Param: 2},
+	})
+	if err == nil {
+		t.Fatal("Wrong sampler probability is accepted")
+	}
+
+	// telemetry is set when meters are created, so it must not be set yet
+	common.SetTelemetry(nil)
+	_, err = New(Options{
+		Metrics: []string{"prometheus"},
+		Tail:    common.TailSamplerOptions{Window: time.Second, Probability: 2},
+	})
+	if err == nil {
+		t.Fatal("Wrong tail sampler probability is accepted")
+	}
+	if common.GetTelemetry() != nil {
+		t.Fatal("Providers are created before tail sampler is validated")
+	}
+}
+
+func TestBootstrapUnselected(t *testing.T) {
+
+	// jaeger has options, but it is not in traces, so it must not be created
+	b, err := New(Options{
+		ServiceName: "service",
+		Stdout:      provider.StdoutOptions{Format: "template", Level: "info", Template: "{{.msg}}"},
+		Jaeger:      provider.JaegerOptions{AgentHost: "127.0.0.1", AgentPort: 6831},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetTelemetry(nil)
+	defer b.Stop()
+
+	if opentracing.IsGlobalTracerRegistered() {
+		t.Fatal("Unselected tracer is created")
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFlag      = "config"
+	configEnvPrefix = "SRE_"
+	configMask      = "******"
+)
+
+var configSecrets = []string{"password", "token", "api-key", "secret"}
+
+type ConfigOptions struct {
+	File   string
+	Format string
+}
+
+var configOptions = ConfigOptions{
+	File:   "",
+	Format: "yaml",
+}
+
+func configEnvName(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configFlatten turns nested keys into flag names, so prometheus: {listen: ...} is prometheus-listen
+func configFlatten(prefix string, m map[string]interface{}, r map[string]interface{}) {
+
+	for k, v := range m {
+		name := k
+		if !utils.IsEmpty(prefix) {
+			name = fmt.Sprintf("%s-%s", prefix, k)
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			configFlatten(name, nested, r)
+			continue
+		}
+		r[name] = v
+	}
+}
+
+func configValue(v interface{}) string {
+
+	arr, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprintf("%v", v)
+	}
+
+	var values []string
+	for _, item := range arr {
+		values = append(values, fmt.Sprintf("%v", item))
+	}
+	return strings.Join(values, ",")
+}
+
+func readConfigFile(file string) (map[string]interface{}, error) {
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(bytes, &m)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bytes, &m)
+	default:
+		return nil, fmt.Errorf("config file %s should be yaml or json", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", file, err)
+	}
+
+	r := make(map[string]interface{})
+	configFlatten("", m, r)
+	return r, nil
+}
+
+// loadConfig sets flags which are not set on command line, environment variables take precedence over config file
+func loadConfig(flags *pflag.FlagSet) error {
+
+	file := configOptions.File
+	if !flags.Changed(configFlag) {
+		if env, ok := os.LookupEnv(configEnvName(configFlag)); ok {
+			file = env
+		}
+	}
+
+	values := make(map[string]interface{})
+	if !utils.IsEmpty(file) {
+		m, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		values = m
+	}
+
+	var unknown []string
+	for k := range values {
+		if k == configFlag || flags.Lookup(k) == nil {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("config file %s has unknown keys: %s", file, strings.Join(unknown, ", "))
+	}
+
+	var errs []string
+	flags.VisitAll(func(f *pflag.Flag) {
+
+		if f.Changed || f.Name == configFlag {
+			return
+		}
+
+		source := ""
+		value := ""
+
+		if env, ok := os.LookupEnv(configEnvName(f.Name)); ok {
+			source = configEnvName(f.Name)
+			value = env
+		} else if v, ok := values[f.Name]; ok {
+			source = fmt.Sprintf("config key %s", f.Name)
+			value = configValue(v)
+		} else {
+			return
+		}
+
+		if err := flags.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func configSecret(name string) bool {
+
+	for _, s := range configSecrets {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveConfig returns values of all flags, secrets are masked
+func effectiveConfig(flags *pflag.FlagSet) map[string]interface{} {
+
+	r := make(map[string]interface{})
+	flags.VisitAll(func(f *pflag.Flag) {
+
+		if f.Name == configFlag || f.Name == "help" {
+			return
+		}
+
+		if configSecret(f.Name) {
+			value := ""
+			if !utils.IsEmpty(f.Value.String()) {
+				value = configMask
+			}
+			r[f.Name] = value
+			return
+		}
+
+		var value interface{}
+		var err error
+
+		switch f.Value.Type() {
+		case "bool":
+			value, err = flags.GetBool(f.Name)
+		case "int":
+			value, err = flags.GetInt(f.Name)
+		case "float64":
+			value, err = flags.GetFloat64(f.Name)
+		case "stringSlice":
+			value, err = flags.GetStringSlice(f.Name)
+		case "float64Slice":
+			value, err = flags.GetFloat64Slice(f.Name)
+		default:
+			value = f.Value.String()
+		}
+		if err != nil {
+			value = f.Value.String()
+		}
+		r[f.Name] = value
+	})
+	return r
+}
+
+func printConfig(w io.Writer, flags *pflag.FlagSet, format string) error {
+
+	config := effectiveConfig(flags)
+
+	switch format {
+	case "json":
+		bytes, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(bytes))
+		return err
+	case "yaml":
+		bytes, err := yaml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes)
+		return err
+	default:
+		return fmt.Errorf("config format %s is not supported", format)
+	}
+}
+
+func newConfigCommand() *cobra.Command {
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Configuration commands",
+		// providers are not needed to deal with configuration
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return loadConfig(cmd.Root().PersistentFlags())
+		},
+	}
+
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration with masked secrets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printConfig(cmd.OutOrStdout(), cmd.Root().PersistentFlags(), configOptions.Format)
+		},
+	}
+	printCmd.Flags().StringVar(&configOptions.Format, "format", configOptions.Format, "Config format: yaml, json")
+
+	configCmd.AddCommand(printCmd)
+	return configCmd
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func configNewFlags(t *testing.T, content string, args ...string) (*pflag.FlagSet, error) {
+
+	file := filepath.Join(t.TempDir(), "sre.yaml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var config, listen, password string
+	var port int
+	var metrics []string
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(&config, configFlag, file, "")
+	flags.StringVar(&listen, "prometheus-listen", "127.0.0.1:8080", "")
+	flags.StringVar(&password, "prometheus-push-password", "", "")
+	flags.IntVar(&port, "statsd-port", 8125, "")
+	flags.StringSliceVar(&metrics, "metrics", []string{"prometheus"}, "")
+
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	configOptions.File = config
+	return flags, loadConfig(flags)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+
+	t.Setenv("SRE_STATSD_PORT", "9125")
+	t.Setenv("SRE_PROMETHEUS_LISTEN", "0.0.0.0:9090")
+
+	flags, err := configNewFlags(t, `
+prometheus:
+  listen: 0.0.0.0:80
+  push-password: secret
+statsd-port: 1
+metrics: [prometheus, statsd]
+`, "--prometheus-listen", "0.0.0.0:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := flags.GetString("prometheus-listen"); v != "0.0.0.0:8080" {
+		t.Fatalf("Flag is overridden: %s", v)
+	}
+	if v, _ := flags.GetInt("statsd-port"); v != 9125 {
+		t.Fatalf("Environment variable is not applied: %d", v)
+	}
+	if v, _ := flags.GetStringSlice("metrics"); strings.Join(v, ",") != "prometheus,statsd" {
+		t.Fatalf("Config list is not applied: %v", v)
+	}
+
+	var bb bytes.Buffer
+	if err := printConfig(&bb, flags, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(bb.String(), "secret") || !strings.Contains(bb.String(), "prometheus-push-password: '******'") {
+		t.Fatalf("Secret is not masked:\n%s", bb.String())
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+
+	if _, err := configNewFlags(t, "prometheus:\n  unknown: 1\nother: 2\n"); err == nil || !strings.Contains(err.Error(), "unknown keys: other, prometheus-unknown") {
+		t.Fatalf("Unknown keys are accepted: %v", err)
+	}
+
+	if _, err := configNewFlags(t, "statsd-port: port\n"); err == nil || !strings.Contains(err.Error(), "config key statsd-port") {
+		t.Fatalf("Wrong value is accepted: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -10,9 +11,9 @@ import (
 	"os/signal"
 	"time"
 
-	"sync"
 	"syscall"
 
+	"github.com/devopsext/sre/bootstrap"
 	common "github.com/devopsext/sre/common"
 	"github.com/devopsext/sre/provider"
 	"github.com/devopsext/utils"
@@ -26,21 +27,29 @@ var traces = common.NewTraces()
 var metrics = common.NewMetrics()
 var events = common.NewEvents()
 var stdout *provider.Stdout
-var mainWG sync.WaitGroup
+var boot *bootstrap.Bootstrap
 
 type RootOptions struct {
-	Logs    []string
-	Metrics []string
-	Traces  []string
-	Events  []string
+	ServiceName      string
+	Environment      string
+	Logs             []string
+	Metrics          []string
+	MetricsMaxSeries int
+	Traces           []string
+	Events           []string
+	ShutdownTimeout  time.Duration
 }
 
 var rootOptions = RootOptions{
 
-	Logs:    []string{"stdout"},
-	Metrics: []string{"prometheus"},
-	Traces:  []string{},
-	Events:  []string{},
+	ServiceName:      "",
+	Environment:      "",
+	Logs:             []string{"stdout"},
+	Metrics:          []string{"prometheus"},
+	MetricsMaxSeries: 1000,
+	Traces:           []string{},
+	Events:           []string{},
+	ShutdownTimeout:  time.Second * 10,
 }
 
 var stdoutOptions = provider.StdoutOptions{
@@ -55,9 +64,55 @@ var stdoutOptions = provider.StdoutOptions{
 
 var prometheusOptions = provider.PrometheusOptions{
 
-	URL:    "/metrics",
-	Listen: "127.0.0.1:8080",
-	Prefix: "sre",
+	URL:          "/metrics",
+	Listen:       "127.0.0.1:8080",
+	Prefix:       "sre",
+	PushURL:      "",
+	PushJob:      "",
+	PushInstance: "",
+	PushInterval: time.Second * 15,
+	PushMethod:   "PUT",
+	PushUsername: "",
+	PushPassword: "",
+	ServiceName:  "",
+	Environment:  "",
+
+	RemoteWriteURL:       "",
+	RemoteWriteInterval:  time.Second * 15,
+	RemoteWriteQueueSize: provider.PrometheusRemoteWriteDefaultQueueSize,
+	RemoteWriteRetries:   provider.PrometheusRemoteWriteDefaultRetries,
+	RemoteWriteUsername:  "",
+	RemoteWritePassword:  "",
+}
+
+var statsdOptions = provider.StatsdOptions{
+	Host:          "",
+	Port:          8125,
+	Prefix:        "sre",
+	Tags:          "",
+	Dialect:       provider.StatsdDialectNone,
+	MTU:           provider.StatsdDefaultMTU,
+	FlushInterval: provider.StatsdDefaultFlushInterval,
+	SampleRate:    1,
+}
+
+var influxdbOptions = provider.InfluxDBOptions{
+	URL:           "",
+	Org:           "",
+	Bucket:        "",
+	Token:         "",
+	Prefix:        "sre",
+	Tags:          "",
+	FlushInterval: provider.InfluxDBDefaultFlushInterval,
+}
+
+var graphiteOptions = provider.GraphiteOptions{
+	Host:          "",
+	Port:          2003,
+	Prefix:        "sre",
+	Protocol:      provider.GraphiteProtocolPlaintext,
+	FlushInterval: provider.GraphiteDefaultFlushInterval,
+	Percentiles:   provider.GraphiteDefaultPercentiles,
 }
 
 var jaegerOptions = provider.JaegerOptions{
@@ -87,9 +142,10 @@ var datadogTracerOptions = provider.DataDogTracerOptions{
 }
 
 var datadogLoggerOptions = provider.DataDogLoggerOptions{
-	AgentHost: "",
-	AgentPort: 10518,
-	Level:     "info",
+	AgentHost:  "",
+	AgentPort:  10518,
+	Level:      "info",
+	BufferSize: provider.AgentWriterDefaultBufferSize,
 }
 
 var datadogMeterOptions = provider.DataDogMeterOptions{
@@ -133,10 +189,11 @@ var newrelicTracerOptions = provider.NewRelicTracerOptions{
 }
 
 var newrelicLoggerOptions = provider.NewRelicLoggerOptions{
-	Endpoint:  "",
-	AgentHost: "",
-	AgentPort: 5171,
-	Level:     "info",
+	Endpoint:   "",
+	AgentHost:  "",
+	AgentPort:  5171,
+	Level:      "info",
+	BufferSize: provider.AgentWriterDefaultBufferSize,
 }
 
 var newrelicMeterOptions = provider.NewRelicMeterOptions{
@@ -148,6 +205,28 @@ var newrelicEventerOptions = provider.NewRelicEventerOptions{
 	Endpoint: "",
 }
 
+var redactorOptions = common.RedactorOptions{
+	Detectors: []string{},
+	Patterns:  []string{},
+	Fields:    []string{},
+	Mask:      common.RedactorDefaultMask,
+}
+
+var samplerOptions = common.SamplerOptions{
+	Type:        common.SamplerTypeAlways,
+	Param:       1,
+	Operations:  []string{},
+	ParentBased: true,
+}
+
+var tailSamplerOptions = common.TailSamplerOptions{
+	Window:      0,
+	MaxTraces:   common.TailSamplerDefaultMaxTraces,
+	Duration:    0,
+	Attributes:  []string{},
+	Probability: 1,
+}
+
 var grafanaOptions = provider.GrafanaOptions{
 	URL:     "",
 	ApiKey:  "admim:admin",
@@ -167,15 +246,25 @@ func interceptSyscall() {
 	go func() {
 		<-c
 		logs.Info("Exiting...")
+		shutdown()
 		os.Exit(1)
 	}()
 }
 
+// shutdown delivers what providers have buffered, errors are logged by bootstrap
+func shutdown() {
+
+	if boot == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootOptions.ShutdownTimeout)
+	defer cancel()
+	boot.Shutdown(ctx)
+}
+
 func Finish() {
-	traces.Stop()
-	metrics.Stop()
-	logs.Stop()
-	events.Stop()
+	shutdown()
 	os.Exit(0)
 }
 
@@ -184,153 +273,56 @@ func Execute() {
 	rootCmd := &cobra.Command{
 		Use:   "sre",
 		Short: "SRE",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 
-			stdoutOptions.Version = VERSION
-			stdout = provider.NewStdout(stdoutOptions)
-			stdout.SetCallerOffset(2)
-			if utils.Contains(rootOptions.Logs, "stdout") {
-				logs.Register(stdout)
+			if err := loadConfig(cmd.Root().PersistentFlags()); err != nil {
+				return err
 			}
 
-			datadogLoggerOptions.Version = VERSION
-			datadogLoggerOptions.ApiKey = datadogOptions.ApiKey
-			datadogLoggerOptions.ServiceName = datadogOptions.ServiceName
-			datadogLoggerOptions.Environment = datadogOptions.Environment
-			datadogLoggerOptions.Tags = datadogOptions.Tags
-			datadogLoggerOptions.Debug = datadogOptions.Debug
-			datadogLogger := provider.NewDataDogLogger(datadogLoggerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Logs, "datadog") && datadogLogger != nil {
-				logs.Register(datadogLogger)
+			b, err := bootstrap.New(bootstrap.Options{
+				ServiceName:      rootOptions.ServiceName,
+				Environment:      rootOptions.Environment,
+				Version:          VERSION,
+				Logs:             rootOptions.Logs,
+				Metrics:          rootOptions.Metrics,
+				MetricsMaxSeries: rootOptions.MetricsMaxSeries,
+				Traces:           rootOptions.Traces,
+				Events:           rootOptions.Events,
+				Stdout:           stdoutOptions,
+				Redactor:         redactorOptions,
+				Sampler:          samplerOptions,
+				Tail:             tailSamplerOptions,
+				Prometheus:       prometheusOptions,
+				Statsd:           statsdOptions,
+				InfluxDB:         influxdbOptions,
+				Graphite:         graphiteOptions,
+				Jaeger:           jaegerOptions,
+				DataDog:          datadogOptions,
+				DataDogLogger:    datadogLoggerOptions,
+				DataDogTracer:    datadogTracerOptions,
+				DataDogMeter:     datadogMeterOptions,
+				DataDogEventer:   datadogEventerOptions,
+				NewRelic:         newrelicOptions,
+				NewRelicLogger:   newrelicLoggerOptions,
+				NewRelicTracer:   newrelicTracerOptions,
+				NewRelicMeter:    newrelicMeterOptions,
+				NewRelicEventer:  newrelicEventerOptions,
+				Grafana:          grafanaOptions,
+				GrafanaEventer:   grafanaEventerOptions,
+			})
+			if err != nil {
+				os.Exit(1)
 			}
 
-			newrelicLoggerOptions.Version = VERSION
-			newrelicLoggerOptions.ApiKey = newrelicOptions.ApiKey
-			newrelicLoggerOptions.ServiceName = newrelicOptions.ServiceName
-			newrelicLoggerOptions.Environment = newrelicOptions.Environment
-			newrelicLoggerOptions.Attributes = newrelicOptions.Attributes
-			newrelicLoggerOptions.Debug = newrelicOptions.Debug
-			newrelicLogger := provider.NewNewRelicLogger(newrelicLoggerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Logs, "newrelic") && newrelicLogger != nil {
-				logs.Register(newrelicLogger)
-			}
+			boot = b
+			stdout = b.Stdout
+			logs = b.Logs
+			traces = b.Traces
+			metrics = b.Metrics
+			events = b.Events
 
 			logs.Info("Booting...")
-
-			// Metrics
-
-			prometheusOptions.Version = VERSION
-			prometheus := provider.NewPrometheusMeter(prometheusOptions, logs, stdout)
-			if utils.Contains(rootOptions.Metrics, "prometheus") && prometheus != nil {
-				prometheus.StartInWaitGroup(&mainWG)
-				metrics.Register(prometheus)
-			}
-
-			datadogMeterOptions.Version = VERSION
-			datadogMeterOptions.ApiKey = datadogOptions.ApiKey
-			datadogMeterOptions.ServiceName = datadogOptions.ServiceName
-			datadogMeterOptions.Environment = datadogOptions.Environment
-			datadogMeterOptions.Tags = datadogOptions.Tags
-			datadogMeterOptions.Debug = datadogOptions.Debug
-			datadogMeter := provider.NewDataDogMeter(datadogMeterOptions, logs, stdout)
-			if utils.Contains(rootOptions.Metrics, "datadog") && datadogMeter != nil {
-				metrics.Register(datadogMeter)
-			}
-
-			/*opentelemetryMeterOptions.Version = VERSION
-			opentelemetryMeterOptions.ServiceName = opentelemetryOptions.ServiceName
-			opentelemetryMeterOptions.Environment = opentelemetryOptions.Environment
-			opentelemetryMeterOptions.Attributes = opentelemetryOptions.Attributes
-			opentelemetryMeterOptions.Debug = opentelemetryOptions.Debug
-			opentelemetryMeter := provider.NewOpentelemetryMeter(opentelemetryMeterOptions, logs, stdout)
-			if utils.Contains(rootOptions.Metrics, "opentelemetry") && opentelemetryMeter != nil {
-				metrics.Register(opentelemetryMeter)
-			}*/
-
-			newrelicMeterOptions.Version = VERSION
-			newrelicMeterOptions.ApiKey = newrelicOptions.ApiKey
-			newrelicMeterOptions.ServiceName = newrelicOptions.ServiceName
-			newrelicMeterOptions.Environment = newrelicOptions.Environment
-			newrelicMeterOptions.Attributes = newrelicOptions.Attributes
-			newrelicMeterOptions.Debug = newrelicOptions.Debug
-			newrelicMeter := provider.NewNewRelicMeter(newrelicMeterOptions, logs, stdout)
-			if utils.Contains(rootOptions.Metrics, "newrelic") && newrelicMeter != nil {
-				metrics.Register(newrelicMeter)
-			}
-
-			// Tracing
-
-			jaegerOptions.Version = VERSION
-			jaeger := provider.NewJaegerTracer(jaegerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Traces, "jaeger") && jaeger != nil {
-				traces.Register(jaeger)
-			}
-
-			datadogTracerOptions.Version = VERSION
-			datadogTracerOptions.ApiKey = datadogOptions.ApiKey
-			datadogTracerOptions.ServiceName = datadogOptions.ServiceName
-			datadogTracerOptions.Environment = datadogOptions.Environment
-			datadogTracerOptions.Tags = datadogOptions.Tags
-			datadogTracerOptions.Debug = datadogOptions.Debug
-			datadogTracer := provider.NewDataDogTracer(datadogTracerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Traces, "datadog") && datadogTracer != nil {
-				traces.Register(datadogTracer)
-			}
-
-			/*opentelemetryTracerOptions.Version = VERSION
-			opentelemetryTracerOptions.ServiceName = opentelemetryOptions.ServiceName
-			opentelemetryTracerOptions.Environment = opentelemetryOptions.Environment
-			opentelemetryTracerOptions.Attributes = opentelemetryOptions.Attributes
-			opentelemetryTracerOptions.Debug = opentelemetryOptions.Debug
-			opentelemtryTracer := provider.NewOpentelemetryTracer(opentelemetryTracerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Traces, "opentelemetry") && opentelemtryTracer != nil {
-				traces.Register(opentelemtryTracer)
-			}*/
-
-			newrelicTracerOptions.Version = VERSION
-			newrelicTracerOptions.ApiKey = newrelicOptions.ApiKey
-			newrelicTracerOptions.ServiceName = newrelicOptions.ServiceName
-			newrelicTracerOptions.Environment = newrelicOptions.Environment
-			newrelicTracerOptions.Attributes = newrelicOptions.Attributes
-			newrelicTracerOptions.Debug = newrelicOptions.Debug
-			newrelicTracer := provider.NewNewRelicTracer(newrelicTracerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Metrics, "newrelic") && newrelicTracer != nil {
-				traces.Register(newrelicTracer)
-			}
-
-			// Events
-			grafanaEventerOptions.Version = VERSION
-			grafanaEventerOptions.URL = grafanaOptions.URL
-			grafanaEventerOptions.ApiKey = grafanaOptions.ApiKey
-			grafanaEventerOptions.Tags = grafanaOptions.Tags
-			grafanaEventerOptions.Timeout = grafanaOptions.Timeout
-			grafanaEventer := provider.NewGrafanaEventer(grafanaEventerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Events, "grafana") && grafanaEventer != nil {
-				events.Register(grafanaEventer)
-			}
-
-			newrelicEventerOptions.Version = VERSION
-			newrelicEventerOptions.ApiKey = newrelicOptions.ApiKey
-			newrelicEventerOptions.ServiceName = newrelicOptions.ServiceName
-			newrelicEventerOptions.Environment = newrelicOptions.Environment
-			newrelicEventerOptions.Attributes = newrelicOptions.Attributes
-			newrelicEventerOptions.Debug = newrelicOptions.Debug
-			newrelicEventer := provider.NewNewRelicEventer(newrelicEventerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Events, "newrelic") && newrelicEventer != nil {
-				events.Register(newrelicEventer)
-			}
-
-			datadogEventerOptions.Version = VERSION
-			datadogEventerOptions.ApiKey = datadogOptions.ApiKey
-			datadogEventerOptions.ServiceName = datadogOptions.ServiceName
-			datadogEventerOptions.Environment = datadogOptions.Environment
-			datadogEventerOptions.Tags = datadogOptions.Tags
-			datadogEventerOptions.Debug = datadogOptions.Debug
-			datadogEventer := provider.NewDataDogEventer(datadogEventerOptions, logs, stdout)
-			if utils.Contains(rootOptions.Events, "datadog") && datadogEventer != nil {
-				events.Register(datadogEventer)
-			}
-
+			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 
@@ -426,17 +418,23 @@ func Execute() {
 			logs.Info("Wait until it will be interrupted...")
 
 			rootSpan.Finish()
-			mainWG.Wait()
+			boot.Wait()
 			Finish()
 		},
 	}
 
 	flags := rootCmd.PersistentFlags()
 
+	flags.StringVar(&configOptions.File, configFlag, configOptions.File, "Config file (yaml, json), flags and SRE_* environment variables take precedence")
+
+	flags.StringVar(&rootOptions.ServiceName, "service-name", rootOptions.ServiceName, "Service name for providers which have no own one")
+	flags.StringVar(&rootOptions.Environment, "environment", rootOptions.Environment, "Environment for providers which have no own one")
 	flags.StringSliceVar(&rootOptions.Logs, "logs", rootOptions.Logs, "Log providers: stdout, datadog, newrelic")
-	flags.StringSliceVar(&rootOptions.Metrics, "metrics", rootOptions.Metrics, "Metric providers: prometheus, datadog, opentelemetry")
-	flags.StringSliceVar(&rootOptions.Traces, "traces", rootOptions.Traces, "Trace providers: jaeger, datadog, opentelemetry")
+	flags.StringSliceVar(&rootOptions.Metrics, "metrics", rootOptions.Metrics, "Metric providers: prometheus, datadog, newrelic, statsd, influxdb, graphite, opentelemetry")
+	flags.IntVar(&rootOptions.MetricsMaxSeries, "metrics-max-series", rootOptions.MetricsMaxSeries, "Metrics max series per metric, 0 means no limit")
+	flags.StringSliceVar(&rootOptions.Traces, "traces", rootOptions.Traces, "Trace providers: jaeger, datadog, newrelic, opentelemetry")
 	flags.StringSliceVar(&rootOptions.Events, "events", rootOptions.Events, "Events providers: grafana, newrelic, datadog")
+	flags.DurationVar(&rootOptions.ShutdownTimeout, "shutdown-timeout", rootOptions.ShutdownTimeout, "Time to deliver buffered logs, metrics, traces and events on exit")
 
 	flags.StringVar(&stdoutOptions.Format, "stdout-format", stdoutOptions.Format, "Stdout format: json, text, template")
 	flags.StringVar(&stdoutOptions.Level, "stdout-level", stdoutOptions.Level, "Stdout level: info, warn, error, debug, panic")
@@ -448,6 +446,45 @@ func Execute() {
 	flags.StringVar(&prometheusOptions.URL, "prometheus-url", prometheusOptions.URL, "Prometheus endpoint url")
 	flags.StringVar(&prometheusOptions.Listen, "prometheus-listen", prometheusOptions.Listen, "Prometheus listen")
 	flags.StringVar(&prometheusOptions.Prefix, "prometheus-prefix", prometheusOptions.Prefix, "Prometheus prefix")
+	flags.StringVar(&prometheusOptions.PushURL, "prometheus-push-url", prometheusOptions.PushURL, "Prometheus pushgateway url")
+	flags.StringVar(&prometheusOptions.PushJob, "prometheus-push-job", prometheusOptions.PushJob, "Prometheus pushgateway job")
+	flags.StringVar(&prometheusOptions.PushInstance, "prometheus-push-instance", prometheusOptions.PushInstance, "Prometheus pushgateway instance")
+	flags.DurationVar(&prometheusOptions.PushInterval, "prometheus-push-interval", prometheusOptions.PushInterval, "Prometheus pushgateway interval")
+	flags.StringVar(&prometheusOptions.PushMethod, "prometheus-push-method", prometheusOptions.PushMethod, "Prometheus pushgateway method: PUT, POST")
+	flags.StringVar(&prometheusOptions.PushUsername, "prometheus-push-username", prometheusOptions.PushUsername, "Prometheus pushgateway username")
+	flags.StringVar(&prometheusOptions.PushPassword, "prometheus-push-password", prometheusOptions.PushPassword, "Prometheus pushgateway password")
+	flags.StringVar(&prometheusOptions.ServiceName, "prometheus-service-name", prometheusOptions.ServiceName, "Prometheus service name")
+	flags.StringVar(&prometheusOptions.Environment, "prometheus-environment", prometheusOptions.Environment, "Prometheus environment")
+	flags.StringVar(&prometheusOptions.RemoteWriteURL, "prometheus-remote-write-url", prometheusOptions.RemoteWriteURL, "Prometheus remote write url")
+	flags.DurationVar(&prometheusOptions.RemoteWriteInterval, "prometheus-remote-write-interval", prometheusOptions.RemoteWriteInterval, "Prometheus remote write interval")
+	flags.IntVar(&prometheusOptions.RemoteWriteQueueSize, "prometheus-remote-write-queue-size", prometheusOptions.RemoteWriteQueueSize, "Prometheus remote write queue size in batches")
+	flags.IntVar(&prometheusOptions.RemoteWriteRetries, "prometheus-remote-write-retries", prometheusOptions.RemoteWriteRetries, "Prometheus remote write retries")
+	flags.StringVar(&prometheusOptions.RemoteWriteUsername, "prometheus-remote-write-username", prometheusOptions.RemoteWriteUsername, "Prometheus remote write username")
+	flags.StringVar(&prometheusOptions.RemoteWritePassword, "prometheus-remote-write-password", prometheusOptions.RemoteWritePassword, "Prometheus remote write password")
+
+	flags.StringVar(&statsdOptions.Host, "statsd-host", statsdOptions.Host, "Statsd host")
+	flags.IntVar(&statsdOptions.Port, "statsd-port", statsdOptions.Port, "Statsd port")
+	flags.StringVar(&statsdOptions.Prefix, "statsd-prefix", statsdOptions.Prefix, "Statsd prefix")
+	flags.StringVar(&statsdOptions.Tags, "statsd-tags", statsdOptions.Tags, "Statsd tags")
+	flags.StringVar(&statsdOptions.Dialect, "statsd-dialect", statsdOptions.Dialect, "Statsd tag dialect: none, dogstatsd, influxdb, graphite")
+	flags.IntVar(&statsdOptions.MTU, "statsd-mtu", statsdOptions.MTU, "Statsd packet size")
+	flags.DurationVar(&statsdOptions.FlushInterval, "statsd-flush-interval", statsdOptions.FlushInterval, "Statsd flush interval")
+	flags.Float64Var(&statsdOptions.SampleRate, "statsd-sample-rate", statsdOptions.SampleRate, "Statsd sample rate for counters and timers")
+
+	flags.StringVar(&influxdbOptions.URL, "influxdb-url", influxdbOptions.URL, "InfluxDB url: http(s)://host:8086 or udp://host:8089")
+	flags.StringVar(&influxdbOptions.Org, "influxdb-org", influxdbOptions.Org, "InfluxDB organization")
+	flags.StringVar(&influxdbOptions.Bucket, "influxdb-bucket", influxdbOptions.Bucket, "InfluxDB bucket")
+	flags.StringVar(&influxdbOptions.Token, "influxdb-token", influxdbOptions.Token, "InfluxDB token")
+	flags.StringVar(&influxdbOptions.Prefix, "influxdb-prefix", influxdbOptions.Prefix, "InfluxDB measurement prefix")
+	flags.StringVar(&influxdbOptions.Tags, "influxdb-tags", influxdbOptions.Tags, "InfluxDB tags")
+	flags.DurationVar(&influxdbOptions.FlushInterval, "influxdb-flush-interval", influxdbOptions.FlushInterval, "InfluxDB flush interval")
+
+	flags.StringVar(&graphiteOptions.Host, "graphite-host", graphiteOptions.Host, "Graphite host")
+	flags.IntVar(&graphiteOptions.Port, "graphite-port", graphiteOptions.Port, "Graphite port")
+	flags.StringVar(&graphiteOptions.Prefix, "graphite-prefix", graphiteOptions.Prefix, "Graphite prefix")
+	flags.StringVar(&graphiteOptions.Protocol, "graphite-protocol", graphiteOptions.Protocol, "Graphite protocol: plaintext, pickle")
+	flags.DurationVar(&graphiteOptions.FlushInterval, "graphite-flush-interval", graphiteOptions.FlushInterval, "Graphite flush interval")
+	flags.Float64SliceVar(&graphiteOptions.Percentiles, "graphite-percentiles", graphiteOptions.Percentiles, "Graphite histogram percentiles")
 
 	flags.StringVar(&jaegerOptions.ServiceName, "jaeger-service-name", jaegerOptions.ServiceName, "Jaeger service name")
 	flags.StringVar(&jaegerOptions.AgentHost, "jaeger-agent-host", jaegerOptions.AgentHost, "Jaeger agent host")
@@ -470,6 +507,7 @@ func Execute() {
 	flags.StringVar(&datadogLoggerOptions.AgentHost, "datadog-logger-agent-host", datadogLoggerOptions.AgentHost, "DataDog logger agent host")
 	flags.IntVar(&datadogLoggerOptions.AgentPort, "datadog-logger-agent-port", datadogLoggerOptions.AgentPort, "Datadog logger agent port")
 	flags.StringVar(&datadogLoggerOptions.Level, "datadog-logger-level", datadogLoggerOptions.Level, "DataDog logger level: info, warn, error, debug, panic")
+	flags.IntVar(&datadogLoggerOptions.BufferSize, "datadog-logger-buffer-size", datadogLoggerOptions.BufferSize, "DataDog logger buffer size while agent is unavailable")
 	flags.StringVar(&datadogMeterOptions.AgentHost, "datadog-meter-agent-host", datadogMeterOptions.AgentHost, "DataDog meter agent host")
 	flags.IntVar(&datadogMeterOptions.AgentPort, "datadog-meter-agent-port", datadogMeterOptions.AgentPort, "Datadog meter agent port")
 	flags.StringVar(&datadogMeterOptions.Prefix, "datadog-meter-prefix", datadogMeterOptions.Prefix, "DataDog meter prefix")
@@ -496,6 +534,7 @@ func Execute() {
 	flags.StringVar(&newrelicLoggerOptions.AgentHost, "newrelic-logger-agent-host", newrelicLoggerOptions.AgentHost, "NewRelic logger agent host")
 	flags.IntVar(&newrelicLoggerOptions.AgentPort, "newrelic-logger-agent-port", newrelicLoggerOptions.AgentPort, "NewRelic logger agent port")
 	flags.StringVar(&newrelicLoggerOptions.Level, "newrelic-logger-level", newrelicLoggerOptions.Level, "NewRelic logger level: info, warn, error, debug, panic")
+	flags.IntVar(&newrelicLoggerOptions.BufferSize, "newrelic-logger-buffer-size", newrelicLoggerOptions.BufferSize, "NewRelic logger buffer size while agent is unavailable")
 	flags.StringVar(&newrelicMeterOptions.Endpoint, "newrelic-meter-endpoint", newrelicMeterOptions.Endpoint, "NewRelic meter endpoint")
 	flags.StringVar(&newrelicMeterOptions.Prefix, "newrelic-meter-prefix", newrelicMeterOptions.Prefix, "NewRelic meter prefix")
 	flags.StringVar(&newrelicEventerOptions.Endpoint, "newrelic-eventer-endpoint", newrelicEventerOptions.Endpoint, "NewRelic eventer endpoint")
@@ -506,8 +545,25 @@ func Execute() {
 	flags.IntVar(&grafanaOptions.Timeout, "grafana-timeout", grafanaOptions.Timeout, "Grafana timeout")
 	flags.StringVar(&grafanaEventerOptions.Endpoint, "grafana-eventer-endpoint", grafanaEventerOptions.Tags, "Grafana eventer endpoint")
 
+	flags.StringSliceVar(&redactorOptions.Detectors, "redactor-detectors", redactorOptions.Detectors, "Redactor detectors: bearer, apikey, email, creditcard")
+	flags.StringSliceVar(&redactorOptions.Patterns, "redactor-patterns", redactorOptions.Patterns, "Redactor regular expressions")
+	flags.StringSliceVar(&redactorOptions.Fields, "redactor-fields", redactorOptions.Fields, "Redactor denied field names")
+	flags.StringVar(&redactorOptions.Mask, "redactor-mask", redactorOptions.Mask, "Redactor mask")
+
+	flags.StringVar(&samplerOptions.Type, "traces-sampler-type", samplerOptions.Type, "Traces sampler type: always, never, probabilistic, ratelimiting")
+	flags.Float64Var(&samplerOptions.Param, "traces-sampler-param", samplerOptions.Param, "Traces sampler param: probability or traces per second")
+	flags.StringSliceVar(&samplerOptions.Operations, "traces-sampler-operations", samplerOptions.Operations, "Traces sampler probabilities of root span names: operation=probability")
+	flags.BoolVar(&samplerOptions.ParentBased, "traces-sampler-parent-based", samplerOptions.ParentBased, "Traces sampler keeps decision of remote parent")
+	flags.DurationVar(&tailSamplerOptions.Window, "traces-tail-window", tailSamplerOptions.Window, "Traces tail sampler window to wait for spans of trace, zero disables it")
+	flags.IntVar(&tailSamplerOptions.MaxTraces, "traces-tail-max-traces", tailSamplerOptions.MaxTraces, "Traces tail sampler max buffered traces")
+	flags.DurationVar(&tailSamplerOptions.Duration, "traces-tail-duration", tailSamplerOptions.Duration, "Traces tail sampler keeps traces with span longer than duration")
+	flags.StringSliceVar(&tailSamplerOptions.Attributes, "traces-tail-attributes", tailSamplerOptions.Attributes, "Traces tail sampler keeps traces with span tag: key=value")
+	flags.Float64Var(&tailSamplerOptions.Probability, "traces-tail-probability", tailSamplerOptions.Probability, "Traces tail sampler probability of other traces")
+
 	interceptSyscall()
 
+	rootCmd.AddCommand(newConfigCommand())
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Print the version number",
@@ -1,10 +1,15 @@
 package common
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Eventer interface {
 	Now(name string, message string, attributes map[string]string) error
 	At(name string, message string, attributes map[string]string, when time.Time) error
 	Interval(name string, message string, attributes map[string]string, begin, end time.Time) error
 	Stop()
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
 }
@@ -1,6 +1,9 @@
 package common
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Events struct {
 	eventers []Eventer
@@ -33,6 +36,25 @@ func (es *Events) Stop() {
 	}
 }
 
+func (es *Events) exporters() []exporter {
+
+	var items []exporter
+	for _, e := range es.eventers {
+		items = append(items, e)
+	}
+	return items
+}
+
+// Flush asks eventers to send what they have buffered without stopping them
+func (es *Events) Flush(ctx context.Context) error {
+	return flush(ctx, es.exporters())
+}
+
+// Shutdown stops eventers in parallel, ctx limits time to deliver buffered events
+func (es *Events) Shutdown(ctx context.Context) error {
+	return shutdown(ctx, es.exporters())
+}
+
 func (es *Events) Register(e Eventer) {
 	if es != nil {
 		es.eventers = append(es.eventers, e)
@@ -1,5 +1,7 @@
 package common
 
+import "context"
+
 type Logger interface {
 	Info(obj interface{}, args ...interface{}) Logger
 	SpanInfo(span TracerSpan, obj interface{}, args ...interface{}) Logger
@@ -13,4 +15,6 @@ type Logger interface {
 	SpanPanic(span TracerSpan, obj interface{}, args ...interface{})
 	Stack(offset int) Logger
 	Stop()
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
 }
@@ -1,16 +1,20 @@
 package common
 
 import (
+	"context"
 	"errors"
 
 	"github.com/devopsext/utils"
 )
 
 type Logs struct {
-	loggers []Logger
+	loggers  []Logger
+	redactor *Redactor
 }
 
 func (ls *Logs) Info(obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.Info(obj, args...)
 	}
@@ -18,6 +22,8 @@ func (ls *Logs) Info(obj interface{}, args ...interface{}) Logger {
 }
 
 func (ls *Logs) SpanInfo(span TracerSpan, obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.SpanInfo(span, obj, args...)
 	}
@@ -25,6 +31,8 @@ func (ls *Logs) SpanInfo(span TracerSpan, obj interface{}, args ...interface{})
 }
 
 func (ls *Logs) Warn(obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.Warn(obj, args...)
 	}
@@ -32,6 +40,8 @@ func (ls *Logs) Warn(obj interface{}, args ...interface{}) Logger {
 }
 
 func (ls *Logs) SpanWarn(span TracerSpan, obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.SpanWarn(span, obj, args...)
 	}
@@ -39,6 +49,8 @@ func (ls *Logs) SpanWarn(span TracerSpan, obj interface{}, args ...interface{})
 }
 
 func (ls *Logs) Error(obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.Error(obj, args...)
 	}
@@ -46,6 +58,8 @@ func (ls *Logs) Error(obj interface{}, args ...interface{}) Logger {
 }
 
 func (ls *Logs) SpanError(span TracerSpan, obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.SpanError(span, obj, args...)
 	}
@@ -69,6 +83,8 @@ func (ls *Logs) SpanError(span TracerSpan, obj interface{}, args ...interface{})
 }
 
 func (ls *Logs) Debug(obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.Debug(obj, args...)
 	}
@@ -76,6 +92,8 @@ func (ls *Logs) Debug(obj interface{}, args ...interface{}) Logger {
 }
 
 func (ls *Logs) SpanDebug(span TracerSpan, obj interface{}, args ...interface{}) Logger {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.SpanDebug(span, obj, args...)
 	}
@@ -83,12 +101,16 @@ func (ls *Logs) SpanDebug(span TracerSpan, obj interface{}, args ...interface{})
 }
 
 func (ls *Logs) Panic(obj interface{}, args ...interface{}) {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.Panic(obj, args...)
 	}
 }
 
 func (ls *Logs) SpanPanic(span TracerSpan, obj interface{}, args ...interface{}) {
+
+	obj, args = ls.redactor.Message(obj, args...)
 	for _, l := range ls.loggers {
 		l.SpanPanic(span, obj, args...)
 	}
@@ -107,6 +129,29 @@ func (ls *Logs) Stop() {
 	}
 }
 
+func (ls *Logs) exporters() []exporter {
+
+	var items []exporter
+	for _, l := range ls.loggers {
+		items = append(items, l)
+	}
+	return items
+}
+
+// Flush asks loggers to send what they have buffered without stopping them
+func (ls *Logs) Flush(ctx context.Context) error {
+	return flush(ctx, ls.exporters())
+}
+
+// Shutdown stops loggers in parallel, ctx limits time to deliver buffered logs
+func (ls *Logs) Shutdown(ctx context.Context) error {
+	return shutdown(ctx, ls.exporters())
+}
+
+func (ls *Logs) SetRedactor(r *Redactor) {
+	ls.redactor = r
+}
+
 func (ls *Logs) Register(l Logger) {
 	if l != nil {
 		ls.loggers = append(ls.loggers, l)
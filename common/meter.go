@@ -1,18 +1,37 @@
 package common
 
+import (
+	"context"
+	"time"
+)
+
 type Labels map[string]string
 
 type Counter interface {
 	Inc() Counter
 	Add(value int) Counter
+	AddWithSpan(value int, span TracerSpanContext) Counter
+}
+
+type FloatCounter interface {
+	Add(value float64) FloatCounter
 }
 
 type Gauge interface {
 	Set(value float64) Gauge
+	Add(value float64) Gauge
+	Sub(value float64) Gauge
+	Inc() Gauge
+	Dec() Gauge
 }
 
 type Histogram interface {
 	Observe(value float64) Histogram
+	ObserveWithSpan(value float64, span TracerSpanContext) Histogram
+}
+
+type Summary interface {
+	Observe(value float64) Summary
 }
 
 type Group interface {
@@ -21,8 +40,14 @@ type Group interface {
 
 type Meter interface {
 	Counter(group, name, description string, labels Labels, prefixes ...string) Counter
+	FloatCounter(group, name, description string, labels Labels, prefixes ...string) FloatCounter
 	Gauge(group, name, description string, labels Labels, prefixes ...string) Gauge
+	ObservableGauge(group, name, description string, labels Labels, callback func() float64, prefixes ...string)
 	Histogram(group, name, description string, labels Labels, prefixes ...string) Histogram
+	HistogramWithBuckets(group, name, description string, labels Labels, buckets []float64, prefixes ...string) Histogram
+	Summary(group, name, description string, labels Labels, quantiles []float64, window time.Duration, prefixes ...string) Summary
 	Group(name string) Group
 	Stop()
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
 }
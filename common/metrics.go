@@ -1,10 +1,30 @@
 package common
 
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MetricsOverflowValue = "__overflow__"
+
+// metricsProvider labels telemetry of records rejected before they reach meters
+const metricsProvider = "metrics"
+
 type MetricsCounter struct {
 	counters map[Meter]Counter
 	metrics  *Metrics
 }
 
+type MetricsFloatCounter struct {
+	counters map[Meter]FloatCounter
+	metrics  *Metrics
+}
+
 type MetricsGauge struct {
 	gauges  map[Meter]Gauge
 	metrics *Metrics
@@ -15,13 +35,73 @@ type MetricsHistogram struct {
 	metrics    *Metrics
 }
 
+type MetricsSummary struct {
+	summaries map[Meter]Summary
+	metrics   *Metrics
+}
+
 type MetricsGroup struct {
 	groups  map[Meter]Group
 	metrics *Metrics
 }
 
+type metricsSeries struct {
+	mutex  sync.Mutex
+	series map[string]bool
+	warned bool
+}
+
 type Metrics struct {
-	meters []Meter
+	meters    []Meter
+	maxSeries int
+	logger    Logger
+	series    sync.Map
+}
+
+func metricsSeriesKey(labels Labels) string {
+
+	var arr []string
+	for k, v := range labels {
+		arr = append(arr, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(arr)
+	return strings.Join(arr, ",")
+}
+
+// limit returns labels as is while metric has less than max series,
+// otherwise values of labels are replaced by overflow value
+func (ms *Metrics) limit(name string, labels Labels, prefixes ...string) Labels {
+
+	if ms.maxSeries <= 0 || len(labels) == 0 {
+		return labels
+	}
+
+	metric := strings.Join(append(append([]string{}, prefixes...), name), "_")
+	s, _ := ms.series.LoadOrStore(metric, &metricsSeries{series: make(map[string]bool)})
+	series := s.(*metricsSeries)
+
+	key := metricsSeriesKey(labels)
+
+	series.mutex.Lock()
+	if series.series[key] || len(series.series) < ms.maxSeries {
+		series.series[key] = true
+		series.mutex.Unlock()
+		return labels
+	}
+	warn := !series.warned
+	series.warned = true
+	series.mutex.Unlock()
+
+	if warn && ms.logger != nil {
+		ms.logger.Warn("Metric %s exceeded %d series, new series go to %s", metric, ms.maxSeries, MetricsOverflowValue)
+	}
+	GetTelemetry().Overflowed(metric, 1)
+
+	overflow := make(Labels)
+	for k := range labels {
+		overflow[k] = MetricsOverflowValue
+	}
+	return overflow
 }
 
 func (mg *MetricsGroup) Clear() {
@@ -31,6 +111,16 @@ func (mg *MetricsGroup) Clear() {
 	}
 }
 
+// monotonic rejects decrements and invalid values once for all meters, as counters are monotonic
+func monotonic(value float64) bool {
+
+	if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		GetTelemetry().Rejected(metricsProvider, TelemetryMetrics, 1)
+		return false
+	}
+	return true
+}
+
 func (msc *MetricsCounter) Inc() Counter {
 
 	for _, m := range msc.counters {
@@ -41,14 +131,30 @@ func (msc *MetricsCounter) Inc() Counter {
 
 func (msc *MetricsCounter) Add(value int) Counter {
 
+	if !monotonic(float64(value)) {
+		return msc
+	}
 	for _, m := range msc.counters {
 		m.Add(value)
 	}
 	return msc
 }
 
+func (msc *MetricsCounter) AddWithSpan(value int, span TracerSpanContext) Counter {
+
+	if !monotonic(float64(value)) {
+		return msc
+	}
+	for _, m := range msc.counters {
+		m.AddWithSpan(value, span)
+	}
+	return msc
+}
+
 func (ms *Metrics) Counter(group, name, description string, labels Labels, prefixes ...string) Counter {
 
+	labels = ms.limit(name, labels, prefixes...)
+
 	counter := MetricsCounter{
 		metrics:  ms,
 		counters: make(map[Meter]Counter),
@@ -64,6 +170,36 @@ func (ms *Metrics) Counter(group, name, description string, labels Labels, prefi
 	return &counter
 }
 
+func (msc *MetricsFloatCounter) Add(value float64) FloatCounter {
+
+	if !monotonic(value) {
+		return msc
+	}
+	for _, m := range msc.counters {
+		m.Add(value)
+	}
+	return msc
+}
+
+func (ms *Metrics) FloatCounter(group, name, description string, labels Labels, prefixes ...string) FloatCounter {
+
+	labels = ms.limit(name, labels, prefixes...)
+
+	counter := MetricsFloatCounter{
+		metrics:  ms,
+		counters: make(map[Meter]FloatCounter),
+	}
+
+	for _, m := range ms.meters {
+
+		c := m.FloatCounter(group, name, description, labels, prefixes...)
+		if c != nil {
+			counter.counters[m] = c
+		}
+	}
+	return &counter
+}
+
 func (msg *MetricsGauge) Set(value float64) Gauge {
 
 	for _, m := range msg.gauges {
@@ -72,8 +208,42 @@ func (msg *MetricsGauge) Set(value float64) Gauge {
 	return msg
 }
 
+func (msg *MetricsGauge) Add(value float64) Gauge {
+
+	for _, m := range msg.gauges {
+		m.Add(value)
+	}
+	return msg
+}
+
+func (msg *MetricsGauge) Sub(value float64) Gauge {
+
+	for _, m := range msg.gauges {
+		m.Sub(value)
+	}
+	return msg
+}
+
+func (msg *MetricsGauge) Inc() Gauge {
+
+	for _, m := range msg.gauges {
+		m.Inc()
+	}
+	return msg
+}
+
+func (msg *MetricsGauge) Dec() Gauge {
+
+	for _, m := range msg.gauges {
+		m.Dec()
+	}
+	return msg
+}
+
 func (ms *Metrics) Gauge(group, name, description string, labels Labels, prefixes ...string) Gauge {
 
+	labels = ms.limit(name, labels, prefixes...)
+
 	gauge := MetricsGauge{
 		metrics: ms,
 		gauges:  make(map[Meter]Gauge),
@@ -89,6 +259,15 @@ func (ms *Metrics) Gauge(group, name, description string, labels Labels, prefixe
 	return &gauge
 }
 
+func (ms *Metrics) ObservableGauge(group, name, description string, labels Labels, callback func() float64, prefixes ...string) {
+
+	labels = ms.limit(name, labels, prefixes...)
+
+	for _, m := range ms.meters {
+		m.ObservableGauge(group, name, description, labels, callback, prefixes...)
+	}
+}
+
 func (msg *MetricsHistogram) Observe(value float64) Histogram {
 	for _, m := range msg.histograms {
 		m.Observe(value)
@@ -96,7 +275,16 @@ func (msg *MetricsHistogram) Observe(value float64) Histogram {
 	return msg
 }
 
+func (msg *MetricsHistogram) ObserveWithSpan(value float64, span TracerSpanContext) Histogram {
+	for _, m := range msg.histograms {
+		m.ObserveWithSpan(value, span)
+	}
+	return msg
+}
+
 func (ms *Metrics) Histogram(group, name, description string, labels Labels, prefixes ...string) Histogram {
+
+	labels = ms.limit(name, labels, prefixes...)
 	histogram := MetricsHistogram{
 		metrics:    ms,
 		histograms: make(map[Meter]Histogram),
@@ -111,6 +299,47 @@ func (ms *Metrics) Histogram(group, name, description string, labels Labels, pre
 	return &histogram
 }
 
+func (ms *Metrics) HistogramWithBuckets(group, name, description string, labels Labels, buckets []float64, prefixes ...string) Histogram {
+
+	labels = ms.limit(name, labels, prefixes...)
+	histogram := MetricsHistogram{
+		metrics:    ms,
+		histograms: make(map[Meter]Histogram),
+	}
+
+	for _, m := range ms.meters {
+		h := m.HistogramWithBuckets(group, name, description, labels, buckets, prefixes...)
+		if h != nil {
+			histogram.histograms[m] = h
+		}
+	}
+	return &histogram
+}
+
+func (mss *MetricsSummary) Observe(value float64) Summary {
+	for _, m := range mss.summaries {
+		m.Observe(value)
+	}
+	return mss
+}
+
+func (ms *Metrics) Summary(group, name, description string, labels Labels, quantiles []float64, window time.Duration, prefixes ...string) Summary {
+
+	labels = ms.limit(name, labels, prefixes...)
+	summary := MetricsSummary{
+		metrics:   ms,
+		summaries: make(map[Meter]Summary),
+	}
+
+	for _, m := range ms.meters {
+		s := m.Summary(group, name, description, labels, quantiles, window, prefixes...)
+		if s != nil {
+			summary.summaries[m] = s
+		}
+	}
+	return &summary
+}
+
 func (ms *Metrics) Group(group string) Group {
 
 	gr := MetricsGroup{
@@ -135,6 +364,40 @@ func (ms *Metrics) Stop() {
 	}
 }
 
+func (ms *Metrics) exporters() []exporter {
+
+	var items []exporter
+	for _, m := range ms.meters {
+		items = append(items, m)
+	}
+	return items
+}
+
+// Flush asks meters to send what they have buffered without stopping them
+func (ms *Metrics) Flush(ctx context.Context) error {
+	return flush(ctx, ms.exporters())
+}
+
+// Shutdown stops meters in parallel, ctx limits time to deliver buffered metrics
+func (ms *Metrics) Shutdown(ctx context.Context) error {
+	return shutdown(ctx, ms.exporters())
+}
+
+// unlimited returns metrics of the same meters without series limit, it's used by telemetry
+// which has bounded labels and reports overflows itself
+func (ms *Metrics) unlimited() Meter {
+	return &Metrics{meters: ms.meters, logger: ms.logger}
+}
+
+// SetMaxSeries limits number of series per metric, 0 means no limit
+func (ms *Metrics) SetMaxSeries(max int) {
+	ms.maxSeries = max
+}
+
+func (ms *Metrics) SetLogger(logger Logger) {
+	ms.logger = logger
+}
+
 func (ms *Metrics) Register(m Meter) {
 	if ms != nil {
 		ms.meters = append(ms.meters, m)
@@ -0,0 +1,117 @@
+package common
+
+import "testing"
+
+func TestMetricsGauge(t *testing.T) {
+
+	first := &telemetryTestMeter{values: make(map[string]float64)}
+	second := &telemetryTestMeter{values: make(map[string]float64)}
+
+	metrics := NewMetrics()
+	metrics.Register(first)
+	metrics.Register(second)
+
+	gauge := metrics.Gauge("", "inflight", "", nil)
+	gauge.Set(1).Inc().Add(5).Sub(2).Dec()
+
+	metrics.ObservableGauge("", "observed", "", nil, func() float64 {
+		return 7
+	})
+
+	for _, m := range []*telemetryTestMeter{first, second} {
+		if v := m.values["inflight{}"]; v != 4 {
+			t.Fatalf("Wrong gauge value: %v", v)
+		}
+		if v := m.values["observed{}"]; v != 7 {
+			t.Fatalf("Wrong observable gauge value: %v", v)
+		}
+	}
+}
+
+func TestMetricsMaxSeries(t *testing.T) {
+
+	meter := &telemetryTestMeter{values: make(map[string]float64)}
+	logger := &redactorTestLogger{}
+
+	metrics := NewMetrics()
+	metrics.Register(meter)
+	metrics.SetMaxSeries(2)
+	metrics.SetLogger(logger)
+
+	SetTelemetry(NewTelemetry(meter))
+	defer SetTelemetry(nil)
+
+	for _, id := range []string{"1", "2", "3", "4", "1"} {
+		metrics.Counter("", "requests", "", Labels{"id": id}, "http").Inc()
+	}
+
+	expected := map[string]float64{
+		"http_requests{id=1}":                               2,
+		"http_requests{id=2}":                               1,
+		"http_requests{id=__overflow__}":                    2,
+		"telemetry_series_overflowed{metric=http_requests}": 2,
+	}
+	for k, v := range expected {
+		if meter.values[k] != v {
+			t.Fatalf("Invalid value %v of %s, expected %v", meter.values[k], k, v)
+		}
+	}
+
+	if len(logger.messages) != 1 {
+		t.Fatalf("Wrong number of warnings: %d", len(logger.messages))
+	}
+}
+
+func TestMetricsCounterRejected(t *testing.T) {
+
+	first := &telemetryTestMeter{values: make(map[string]float64)}
+	second := &telemetryTestMeter{values: make(map[string]float64)}
+
+	metrics := NewMetrics()
+	metrics.Register(first)
+	metrics.Register(second)
+
+	telemetry := &telemetryTestMeter{values: make(map[string]float64)}
+	SetTelemetry(NewTelemetry(telemetry))
+	defer SetTelemetry(nil)
+
+	// decrements are rejected once, not by every meter
+	metrics.Counter("", "requests", "", nil).Add(2).Add(-1).AddWithSpan(-1, nil)
+
+	for _, m := range []*telemetryTestMeter{first, second} {
+		if v := m.values["requests{}"]; v != 2 {
+			t.Fatalf("Wrong counter value: %v", v)
+		}
+	}
+	if v := telemetry.values["telemetry_records_rejected{provider=metrics,signal=metrics}"]; v != 2 {
+		t.Fatalf("Wrong number of rejected records: %v", v)
+	}
+}
+
+func TestMetricsMaxSeriesTelemetry(t *testing.T) {
+
+	meter := &telemetryTestMeter{values: make(map[string]float64)}
+
+	metrics := NewMetrics()
+	metrics.Register(meter)
+	metrics.SetMaxSeries(1)
+
+	// own telemetry is not limited, user metrics with the same prefix are
+	telemetry := NewTelemetry(metrics)
+	telemetry.Sent("newrelic", TelemetryLogs, 1)
+	telemetry.Sent("datadog", TelemetryLogs, 1)
+	metrics.Counter("", "records_sent", "", Labels{"provider": "a"}, "telemetry").Inc()
+	metrics.Counter("", "records_sent", "", Labels{"provider": "b"}, "telemetry").Inc()
+
+	expected := map[string]float64{
+		"telemetry_records_sent{provider=newrelic,signal=logs}": 1,
+		"telemetry_records_sent{provider=datadog,signal=logs}":  1,
+		"telemetry_records_sent{provider=a}":                    1,
+		"telemetry_records_sent{provider=__overflow__}":         1,
+	}
+	for k, v := range expected {
+		if meter.values[k] != v {
+			t.Fatalf("Invalid value %v of %s, expected %v", meter.values[k], k, v)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	utils "github.com/devopsext/utils"
+)
+
+// MetricNaming sanitizes and validates metric, label names and escapes label values for a backend
+type MetricNaming struct {
+	separator string
+	escaper   *strings.Replacer
+	reserved  string
+}
+
+var metricNamingInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+var (
+	PrometheusMetricNaming = NewMetricNaming("_", strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`), "__")
+	DataDogMetricNaming    = NewMetricNaming(".", strings.NewReplacer(",", "_", "|", "_", "\n", " "), "")
+	NewRelicMetricNaming   = NewMetricNaming(".", nil, "")
+	GraphiteMetricNaming   = NewMetricNaming(".", nil, "")
+	InfluxDBMetricNaming   = NewMetricNaming("_", strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`, "\n", `\ `), "")
+	StatsdMetricNaming     = NewMetricNaming(".", strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", ";", "_", "=", "_", " ", "_", "\n", "_"), "")
+)
+
+func (mn *MetricNaming) sanitize(s string) string {
+	return metricNamingInvalid.ReplaceAllString(strings.TrimSpace(s), "_")
+}
+
+func (mn *MetricNaming) validate(kind, s string) error {
+
+	if utils.IsEmpty(s) {
+		return fmt.Errorf("%s is empty", kind)
+	}
+
+	c := s[0]
+	if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+		return fmt.Errorf("%s %q should start with a letter or underscore", kind, s)
+	}
+	return nil
+}
+
+// Name joins non empty parts by backend separator, invalid characters are replaced by underscore
+func (mn *MetricNaming) Name(parts ...string) (string, error) {
+
+	var names []string
+	for _, p := range parts {
+		p = mn.sanitize(p)
+		if utils.IsEmpty(p) {
+			continue
+		}
+		names = append(names, p)
+	}
+
+	name := strings.Join(names, mn.separator)
+	if err := mn.validate("metric name", name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (mn *MetricNaming) Label(name string) (string, error) {
+
+	label := mn.sanitize(name)
+	if err := mn.validate("label name", label); err != nil {
+		return "", err
+	}
+
+	if !utils.IsEmpty(mn.reserved) && strings.HasPrefix(label, mn.reserved) {
+		return "", fmt.Errorf("label name %q is reserved", label)
+	}
+	return label, nil
+}
+
+func (mn *MetricNaming) Value(value string) string {
+
+	if mn.escaper == nil {
+		return value
+	}
+	return mn.escaper.Replace(value)
+}
+
+// Labels returns labels with sanitized names and escaped values
+func (mn *MetricNaming) Labels(labels Labels) (Labels, error) {
+
+	r := make(Labels)
+	for k, v := range labels {
+
+		label, err := mn.Label(k)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := r[label]; ok {
+			return nil, fmt.Errorf("label name %q is duplicated after sanitizing", label)
+		}
+		r[label] = mn.Value(v)
+	}
+	return r, nil
+}
+
+func NewMetricNaming(separator string, escaper *strings.Replacer, reserved string) *MetricNaming {
+
+	return &MetricNaming{
+		separator: separator,
+		escaper:   escaper,
+		reserved:  reserved,
+	}
+}
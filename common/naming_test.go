@@ -0,0 +1,71 @@
+package common
+
+import "testing"
+
+func TestMetricNamingName(t *testing.T) {
+
+	name, err := PrometheusMetricNaming.Name("sre", "", "http-server", "requests.total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "sre_http_server_requests_total" {
+		t.Fatalf("Wrong prometheus name: %s", name)
+	}
+
+	name, err = DataDogMetricNaming.Name("", "http", "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "http.requests" {
+		t.Fatalf("Wrong datadog name: %s", name)
+	}
+
+	if _, err := PrometheusMetricNaming.Name("", " "); err == nil {
+		t.Fatal("Empty name is accepted")
+	}
+
+	if _, err := NewRelicMetricNaming.Name("1xx", "requests"); err == nil {
+		t.Fatal("Name started with digit is accepted")
+	}
+}
+
+func TestMetricNamingLabels(t *testing.T) {
+
+	labels, err := PrometheusMetricNaming.Labels(Labels{
+		"http-code": "200",
+		"path":      "/a\"b\\c\nd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["http_code"] != "200" {
+		t.Fatalf("Wrong label name: %v", labels)
+	}
+	if labels["path"] != `/a\"b\\c\nd` {
+		t.Fatalf("Wrong label value: %s", labels["path"])
+	}
+
+	if _, err := PrometheusMetricNaming.Labels(Labels{"__name__": "x"}); err == nil {
+		t.Fatal("Reserved label is accepted")
+	}
+
+	if _, err := PrometheusMetricNaming.Labels(Labels{"a-b": "1", "a_b": "2"}); err == nil {
+		t.Fatal("Duplicated label is accepted")
+	}
+
+	labels, err = DataDogMetricNaming.Labels(Labels{"path": "a,b|c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["path"] != "a_b_c" {
+		t.Fatalf("Wrong datadog label value: %s", labels["path"])
+	}
+
+	labels, err = StatsdMetricNaming.Labels(Labels{"path": "a:b=c;d e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["path"] != "a_b_c_d_e" {
+		t.Fatalf("Wrong statsd label value: %s", labels["path"])
+	}
+}
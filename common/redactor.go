@@ -0,0 +1,205 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	RedactorDetectorBearer     = "bearer"
+	RedactorDetectorApiKey     = "apikey"
+	RedactorDetectorEmail      = "email"
+	RedactorDetectorCreditCard = "creditcard"
+)
+
+const RedactorDefaultMask = "[REDACTED]"
+
+type RedactorOptions struct {
+	Detectors []string
+	Patterns  []string
+	Fields    []string
+	Mask      string
+}
+
+type redactorRule struct {
+	regexp  *regexp.Regexp
+	replace func(r *Redactor, match []string) string
+}
+
+type Redactor struct {
+	options RedactorOptions
+	rules   []redactorRule
+	fields  map[string]bool
+}
+
+func redactorLuhn(digits string) bool {
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d = d * 2
+			if d > 9 {
+				d = d - 9
+			}
+		}
+		sum = sum + d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var redactorDetectors = map[string]redactorRule{
+	RedactorDetectorBearer: {
+		regexp: regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-\._~\+/]+=*`),
+		replace: func(r *Redactor, match []string) string {
+			return fmt.Sprintf("%s %s", match[1], r.options.Mask)
+		},
+	},
+	RedactorDetectorApiKey: {
+		regexp: regexp.MustCompile(`(?i)\b((?:x[_-]?)?api[_-]?key|access[_-]?token|auth[_-]?token|secret|password)(["']?\s*[:=]\s*["']?)[^\s"',;&]+`),
+		replace: func(r *Redactor, match []string) string {
+			return fmt.Sprintf("%s%s%s", match[1], match[2], r.options.Mask)
+		},
+	},
+	RedactorDetectorEmail: {
+		regexp: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		replace: func(r *Redactor, match []string) string {
+			return r.options.Mask
+		},
+	},
+	RedactorDetectorCreditCard: {
+		regexp: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		replace: func(r *Redactor, match []string) string {
+			digits := strings.NewReplacer(" ", "", "-", "").Replace(match[0])
+			if !redactorLuhn(digits) {
+				return match[0]
+			}
+			return r.options.Mask
+		},
+	},
+}
+
+func (r *Redactor) apply(rule redactorRule, s string) string {
+
+	return rule.regexp.ReplaceAllStringFunc(s, func(m string) string {
+		return rule.replace(r, rule.regexp.FindStringSubmatch(m))
+	})
+}
+
+// String returns s with every detected secret replaced by the mask
+func (r *Redactor) String(s string) string {
+
+	if r == nil || utils.IsEmpty(s) {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = r.apply(rule, s)
+	}
+	return s
+}
+
+// Field returns mask if name is denied, otherwise value is redacted as usual
+func (r *Redactor) Field(name string, value interface{}) interface{} {
+
+	if r == nil {
+		return value
+	}
+
+	if r.fields[strings.ToLower(name)] {
+		return r.options.Mask
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case error:
+		return r.String(v.Error())
+	case fmt.Stringer:
+		return r.String(v.String())
+	default:
+		return value
+	}
+}
+
+// Message formats obj with args the same way loggers do and redacts the result
+func (r *Redactor) Message(obj interface{}, args ...interface{}) (interface{}, []interface{}) {
+
+	if r == nil {
+		return obj, args
+	}
+
+	message := ""
+	switch v := obj.(type) {
+	case error:
+		message = v.Error()
+	case string:
+		message = v
+	default:
+		return obj, args
+	}
+
+	if len(args) > 0 {
+		message = fmt.Sprintf(message, args...)
+	}
+	return r.String(message), nil
+}
+
+func NewRedactor(options RedactorOptions) (*Redactor, error) {
+
+	if utils.IsEmpty(options.Mask) {
+		options.Mask = RedactorDefaultMask
+	}
+
+	r := &Redactor{
+		options: options,
+		fields:  make(map[string]bool),
+	}
+
+	for _, name := range options.Detectors {
+		rule, ok := redactorDetectors[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown redactor detector %q", name)
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	for _, pattern := range options.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, redactorRule{
+			regexp: re,
+			replace: func(r *Redactor, match []string) string {
+				return r.options.Mask
+			},
+		})
+	}
+
+	var names []string
+	for _, name := range options.Fields {
+		name = strings.TrimSpace(name)
+		if utils.IsEmpty(name) {
+			continue
+		}
+		r.fields[strings.ToLower(name)] = true
+		names = append(names, regexp.QuoteMeta(name))
+	}
+
+	// denied fields are also masked inside messages like name=value or "name": "value"
+	if len(names) > 0 {
+		re := regexp.MustCompile(fmt.Sprintf(`(?i)\b(%s)(["']?\s*[:=]\s*["']?)[^\s"',;&]+`, strings.Join(names, "|")))
+		r.rules = append(r.rules, redactorRule{
+			regexp: re,
+			replace: func(r *Redactor, match []string) string {
+				return fmt.Sprintf("%s%s%s", match[1], match[2], r.options.Mask)
+			},
+		})
+	}
+	return r, nil
+}
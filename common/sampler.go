@@ -0,0 +1,140 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	SamplerTypeAlways        = "always"
+	SamplerTypeNever         = "never"
+	SamplerTypeProbabilistic = "probabilistic"
+	SamplerTypeRateLimiting  = "ratelimiting"
+)
+
+// samplerMaxTraceID is the same boundary as Jaeger uses, so the same trace ID gets the same decision
+const samplerMaxTraceID = uint64(math.MaxInt64)
+
+type SamplerOptions struct {
+	Type        string
+	Param       float64  // probability for probabilistic, traces per second for ratelimiting
+	Operations  []string // operation=probability rules for root spans
+	ParentBased bool     // keep decision of remote parent
+}
+
+type Sampler struct {
+	options    SamplerOptions
+	operations map[string]float64
+	mutex      sync.Mutex
+	balance    float64
+	last       time.Time
+}
+
+// SampledTracer is implemented by tracers which tell their backend that trace is already sampled
+type SampledTracer interface {
+	SetSampler(s *Sampler)
+}
+
+func samplerProbabilistic(traceID string, probability float64) bool {
+
+	boundary := uint64(probability * float64(samplerMaxTraceID))
+	return TraceIDHexToUint64(traceID)&samplerMaxTraceID < boundary
+}
+
+// rateLimiting is a token bucket refilled by Param per second
+func (s *Sampler) rateLimiting() bool {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	max := math.Max(s.options.Param, 1)
+	now := time.Now()
+	if !s.last.IsZero() {
+		s.balance = math.Min(max, s.balance+now.Sub(s.last).Seconds()*s.options.Param)
+	}
+	s.last = now
+
+	if s.balance < 1 {
+		return false
+	}
+	s.balance = s.balance - 1
+	return true
+}
+
+// Sample decides whether trace is kept, operation is empty if span has no name
+func (s *Sampler) Sample(traceID, operation string) bool {
+
+	if s == nil {
+		return true
+	}
+
+	if probability, ok := s.operations[operation]; ok && !utils.IsEmpty(operation) {
+		return samplerProbabilistic(traceID, probability)
+	}
+
+	switch s.options.Type {
+	case SamplerTypeNever:
+		return false
+	case SamplerTypeProbabilistic:
+		return samplerProbabilistic(traceID, s.options.Param)
+	case SamplerTypeRateLimiting:
+		return s.rateLimiting()
+	}
+	return true
+}
+
+func (s *Sampler) hasOperations() bool {
+	return s != nil && len(s.operations) > 0
+}
+
+func (s *Sampler) parentBased() bool {
+	return s == nil || s.options.ParentBased
+}
+
+func NewSampler(options SamplerOptions) (*Sampler, error) {
+
+	options.Type = strings.ToLower(strings.TrimSpace(options.Type))
+	if utils.IsEmpty(options.Type) {
+		options.Type = SamplerTypeAlways
+	}
+
+	switch options.Type {
+	case SamplerTypeAlways, SamplerTypeNever:
+	case SamplerTypeProbabilistic:
+		if options.Param < 0 || options.Param > 1 {
+			return nil, fmt.Errorf("sampler probability %v is out of [0, 1]", options.Param)
+		}
+	case SamplerTypeRateLimiting:
+		if options.Param < 0 {
+			return nil, fmt.Errorf("sampler rate %v is negative", options.Param)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sampler type %q", options.Type)
+	}
+
+	s := &Sampler{
+		options:    options,
+		operations: make(map[string]float64),
+		balance:    math.Max(options.Param, 1),
+	}
+
+	for _, rule := range options.Operations {
+
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("sampler operation %q is not operation=probability", rule)
+		}
+		probability, err := strconv.ParseFloat(strings.TrimSpace(rule[i+1:]), 64)
+		if err != nil || probability < 0 || probability > 1 {
+			return nil, fmt.Errorf("sampler operation %q has wrong probability", rule)
+		}
+		s.operations[strings.TrimSpace(rule[:i])] = probability
+	}
+	return s, nil
+}
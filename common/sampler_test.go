@@ -0,0 +1,264 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type samplerTestSpan struct {
+	traceID  string
+	spanID   string
+	name     string
+	started  time.Time
+	finished bool
+}
+
+type samplerTestTracer struct {
+	spans []*samplerTestSpan
+}
+
+func (s *samplerTestSpan) GetTraceID() string {
+	return s.traceID
+}
+
+func (s *samplerTestSpan) GetSpanID() string {
+	return s.spanID
+}
+
+func (s *samplerTestSpan) GetContext() TracerSpanContext {
+	return s
+}
+
+func (s *samplerTestSpan) SetCarrier(object interface{}) TracerSpan {
+	if h, ok := object.(http.Header); ok {
+		h.Set("X-Trace-Id", s.traceID)
+	}
+	return s
+}
+
+func (s *samplerTestSpan) SetName(name string) TracerSpan {
+	s.name = name
+	return s
+}
+
+func (s *samplerTestSpan) SetTag(key string, value interface{}) TracerSpan {
+	return s
+}
+
+func (s *samplerTestSpan) Error(err error) TracerSpan {
+	return s
+}
+
+func (s *samplerTestSpan) SetBaggageItem(restrictedKey, value string) TracerSpan {
+	return s
+}
+
+func (s *samplerTestSpan) Finish() {
+	s.finished = true
+}
+
+func (t *samplerTestTracer) start(traceID string) TracerSpan {
+	return t.startAt(traceID, time.Now())
+}
+
+func (t *samplerTestTracer) startAt(traceID string, started time.Time) TracerSpan {
+
+	s := &samplerTestSpan{traceID: traceID, spanID: NewSpanID(), started: started}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func (t *samplerTestTracer) parent(object interface{}) string {
+
+	if h, ok := object.(http.Header); ok {
+		return h.Get("X-Trace-Id")
+	}
+	if sc, ok := object.(TracerSpanContext); ok && sc != nil {
+		return sc.GetTraceID()
+	}
+	return ""
+}
+
+func (t *samplerTestTracer) StartSpan() TracerSpan {
+	return t.start(NewTraceID())
+}
+
+func (t *samplerTestTracer) StartSpanWithTraceID(traceID, spanID string) TracerSpan {
+	return t.start(traceID)
+}
+
+func (t *samplerTestTracer) StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) TracerSpan {
+	return t.startAt(traceID, started)
+}
+
+func (t *samplerTestTracer) StartChildSpan(object interface{}) TracerSpan {
+	if traceID := t.parent(object); traceID != "" {
+		return t.start(traceID)
+	}
+	return nil
+}
+
+func (t *samplerTestTracer) StartFollowSpan(object interface{}) TracerSpan {
+	return t.StartChildSpan(object)
+}
+
+func (t *samplerTestTracer) Stop() {}
+
+func (t *samplerTestTracer) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (t *samplerTestTracer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func samplerNewTraces(t *testing.T, options SamplerOptions) (*Traces, *samplerTestTracer, *samplerTestTracer) {
+
+	s, err := NewSampler(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := &samplerTestTracer{}
+	t2 := &samplerTestTracer{}
+	traces := NewTraces()
+	traces.Register(t1)
+	traces.Register(t2)
+	traces.SetSampler(s)
+	return traces, t1, t2
+}
+
+func TestSamplerProbabilistic(t *testing.T) {
+
+	s, err := NewSampler(SamplerOptions{Type: SamplerTypeProbabilistic, Param: 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+
+		traceID := NewTraceID()
+		sampled := s.Sample(traceID, "")
+		if sampled != s.Sample(traceID, "") {
+			t.Fatal("Decision is not the same for trace ID")
+		}
+		if sampled {
+			kept++
+		}
+	}
+	if kept < 2000 || kept > 3000 {
+		t.Fatalf("Wrong number of kept traces: %d", kept)
+	}
+
+	if !s.Sample(TraceIDUint64ToHex(1), "") || s.Sample(TraceIDUint64ToHex(samplerMaxTraceID), "") {
+		t.Fatal("Wrong decision on bounds")
+	}
+}
+
+func TestSamplerRateLimiting(t *testing.T) {
+
+	s, err := NewSampler(SamplerOptions{Type: SamplerTypeRateLimiting, Param: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := 0
+	for i := 0; i < 10; i++ {
+		if s.Sample(NewTraceID(), "") {
+			kept++
+		}
+	}
+	if kept != 2 {
+		t.Fatalf("Wrong number of kept traces: %d", kept)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if !s.Sample(NewTraceID(), "") {
+		t.Fatal("Balance is not refilled")
+	}
+}
+
+func TestSamplerWrongOptions(t *testing.T) {
+
+	wrong := []SamplerOptions{
+		{Type: "unknown"},
+		{Type: SamplerTypeProbabilistic, Param: 2},
+		{Type: SamplerTypeRateLimiting, Param: -1},
+		{Operations: []string{"health"}},
+		{Operations: []string{"health=high"}},
+	}
+	for _, options := range wrong {
+		if _, err := NewSampler(options); err == nil {
+			t.Fatalf("Wrong options are accepted: %v", options)
+		}
+	}
+}
+
+func TestSamplerTraces(t *testing.T) {
+
+	traces, t1, t2 := samplerNewTraces(t, SamplerOptions{Type: SamplerTypeNever})
+
+	root := traces.StartSpan()
+	child := traces.StartChildSpan(root.GetContext())
+	child.Finish()
+	root.Finish()
+
+	if len(t1.spans) != 0 || len(t2.spans) != 0 {
+		t.Fatal("Dropped spans reached tracers")
+	}
+	if root.GetContext().GetTraceID() == "" || child.GetContext().GetTraceID() != root.GetContext().GetTraceID() {
+		t.Fatal("Dropped spans have no trace ID")
+	}
+
+	// remote parent is kept, as it's parent based
+	traces, t1, t2 = samplerNewTraces(t, SamplerOptions{Type: SamplerTypeNever, ParentBased: true})
+	headers := http.Header{}
+	headers.Set("X-Trace-Id", NewTraceID())
+	traces.StartChildSpan(headers).Finish()
+
+	if len(t1.spans) != 1 || len(t2.spans) != 1 {
+		t.Fatal("Remote parent decision is not kept")
+	}
+
+	traces, t1, t2 = samplerNewTraces(t, SamplerOptions{Type: SamplerTypeNever})
+	traces.StartFollowSpan(headers).Finish()
+	if len(t1.spans) != 1 || t1.spans[0].finished {
+		t.Fatal("Remote parent decision is kept")
+	}
+}
+
+func TestSamplerOperations(t *testing.T) {
+
+	traces, t1, t2 := samplerNewTraces(t, SamplerOptions{
+		Type:       SamplerTypeAlways,
+		Operations: []string{"health=0", "checkout=1"},
+	})
+
+	health := traces.StartSpan().SetName("health")
+	traces.StartChildSpan(health.GetContext()).SetName("db").Finish()
+	health.Finish()
+
+	// pending span is started by tracers when it was created, not when it got name
+	created := time.Now()
+	checkout := traces.StartSpan()
+	time.Sleep(time.Millisecond * 50)
+	checkout.SetName("checkout")
+	traces.StartChildSpan(checkout.GetContext()).SetName("db").Finish()
+	checkout.Finish()
+
+	for _, tracer := range []*samplerTestTracer{t1, t2} {
+
+		if len(tracer.spans) != 2 {
+			t.Fatalf("Wrong number of spans: %d", len(tracer.spans))
+		}
+		if tracer.spans[0].name != "checkout" || tracer.spans[1].name != "db" || !tracer.spans[0].finished {
+			t.Fatalf("Wrong spans: %v, %v", tracer.spans[0], tracer.spans[1])
+		}
+		if tracer.spans[0].started.Sub(created) >= time.Millisecond*50 {
+			t.Fatal("Span is started when it got name")
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	TailSamplerDefaultWindow    = 10 * time.Second
+	TailSamplerDefaultMaxTraces = 10000
+)
+
+type TailSamplerOptions struct {
+	Window      time.Duration // time to wait for spans of trace since its first finished span
+	MaxTraces   int           // traces over max are decided before window
+	Duration    time.Duration // keep traces with span longer than duration
+	Attributes  []string      // keep traces with span tag key=value
+	Probability float64       // keep other traces with probability
+}
+
+// TailSamplerSpan is finished span which is held by tail sampler until decision on its trace
+type TailSamplerSpan struct {
+	TraceID  string
+	Name     string
+	Duration time.Duration
+	Error    bool
+	Tags     map[string]interface{}
+}
+
+type tailSamplerItem struct {
+	span   TailSamplerSpan
+	export func()
+}
+
+type tailSamplerTrace struct {
+	started time.Time
+	items   []tailSamplerItem
+}
+
+// TailSampler buffers finished spans per trace and forwards them to tracers only if trace is kept
+type TailSampler struct {
+	options    TailSamplerOptions
+	attributes map[string]string
+	mutex      sync.Mutex
+	traces     map[string]*tailSamplerTrace
+	order      []string
+	decisions  map[string]bool
+	decided    []string
+	done       chan struct{}
+	once       sync.Once
+	wg         sync.WaitGroup
+}
+
+// TailSampledTracer is implemented by tracers which send span data from this process
+type TailSampledTracer interface {
+	SetTailSampler(s *TailSampler)
+}
+
+func (s *TailSampler) keep(traceID string, items []tailSamplerItem) bool {
+
+	for _, item := range items {
+
+		if item.span.Error {
+			return true
+		}
+		if s.options.Duration > 0 && item.span.Duration >= s.options.Duration {
+			return true
+		}
+		for k, v := range s.attributes {
+			if tag, ok := item.span.Tags[k]; ok && fmt.Sprintf("%v", tag) == v {
+				return true
+			}
+		}
+	}
+	return samplerProbabilistic(traceID, s.options.Probability)
+}
+
+// remember keeps decision for spans which are finished after window
+func (s *TailSampler) remember(traceID string, keep bool) {
+
+	if _, ok := s.decisions[traceID]; !ok {
+		s.decided = append(s.decided, traceID)
+	}
+	s.decisions[traceID] = keep
+
+	if len(s.decided) > s.options.MaxTraces {
+		delete(s.decisions, s.decided[0])
+		s.decided = s.decided[1:]
+	}
+}
+
+// decide keeps or drops traces started before, all of them if before is zero, and exports kept spans
+func (s *TailSampler) decide(before time.Time) {
+
+	var exports []func()
+	dropped := 0
+
+	s.mutex.Lock()
+	for len(s.order) > 0 {
+
+		traceID := s.order[0]
+		trace := s.traces[traceID]
+		if !before.IsZero() && trace.started.After(before) && len(s.order) <= s.options.MaxTraces {
+			break
+		}
+		delete(s.traces, traceID)
+		s.order = s.order[1:]
+
+		keep := s.keep(traceID, trace.items)
+		s.remember(traceID, keep)
+		if !keep {
+			dropped = dropped + len(trace.items)
+			continue
+		}
+		for _, item := range trace.items {
+			exports = append(exports, item.export)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, export := range exports {
+		export()
+	}
+	GetTelemetry().Dropped("tailsampler", TelemetryTraces, dropped)
+}
+
+func (s *TailSampler) run() {
+
+	defer s.wg.Done()
+
+	tick := s.options.Window / 4
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.decide(time.Now().Add(-s.options.Window))
+		}
+	}
+}
+
+// Add holds span until its trace is decided, export sends span to tracer
+func (s *TailSampler) Add(span TailSamplerSpan, export func()) {
+
+	if s == nil {
+		export()
+		return
+	}
+
+	// tracers are stopped after sampler, so late spans are not held
+	select {
+	case <-s.done:
+		export()
+		return
+	default:
+	}
+
+	s.mutex.Lock()
+
+	keep, ok := s.decisions[span.TraceID]
+	if !ok {
+		trace := s.traces[span.TraceID]
+		if trace == nil {
+			trace = &tailSamplerTrace{started: time.Now()}
+			s.traces[span.TraceID] = trace
+			s.order = append(s.order, span.TraceID)
+		}
+		trace.items = append(trace.items, tailSamplerItem{span: span, export: export})
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+	if keep {
+		export()
+		return
+	}
+	GetTelemetry().Dropped("tailsampler", TelemetryTraces, 1)
+}
+
+// Flush decides on all buffered traces without waiting for window
+func (s *TailSampler) Flush(ctx context.Context) error {
+
+	if s == nil {
+		return nil
+	}
+	s.decide(time.Time{})
+	return ctx.Err()
+}
+
+// Shutdown stops waiting for windows and decides on all buffered traces
+func (s *TailSampler) Shutdown(ctx context.Context) error {
+
+	if s == nil {
+		return nil
+	}
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return s.Flush(ctx)
+}
+
+func NewTailSampler(options TailSamplerOptions) (*TailSampler, error) {
+
+	if options.Window <= 0 {
+		options.Window = TailSamplerDefaultWindow
+	}
+	if options.MaxTraces <= 0 {
+		options.MaxTraces = TailSamplerDefaultMaxTraces
+	}
+	if options.Probability < 0 || options.Probability > 1 {
+		return nil, fmt.Errorf("tail sampler probability %v is out of [0, 1]", options.Probability)
+	}
+
+	s := &TailSampler{
+		options:    options,
+		attributes: make(map[string]string),
+		traces:     make(map[string]*tailSamplerTrace),
+		decisions:  make(map[string]bool),
+		done:       make(chan struct{}),
+	}
+
+	for _, attribute := range options.Attributes {
+
+		i := strings.Index(attribute, "=")
+		if i <= 0 || utils.IsEmpty(strings.TrimSpace(attribute[:i])) {
+			return nil, fmt.Errorf("tail sampler attribute %q is not key=value", attribute)
+		}
+		s.attributes[strings.TrimSpace(attribute[:i])] = strings.TrimSpace(attribute[i+1:])
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
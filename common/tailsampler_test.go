@@ -0,0 +1,112 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tailSamplerTestExporter struct {
+	mutex sync.Mutex
+	names []string
+}
+
+func (e *tailSamplerTestExporter) add(s *TailSampler, traceID, name string, duration time.Duration, err bool, tags map[string]interface{}) {
+
+	s.Add(TailSamplerSpan{TraceID: traceID, Name: name, Duration: duration, Error: err, Tags: tags}, func() {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		e.names = append(e.names, name)
+	})
+}
+
+func (e *tailSamplerTestExporter) exported() string {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	names := append([]string{}, e.names...)
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestTailSampler(t *testing.T) {
+
+	s, err := NewTailSampler(TailSamplerOptions{
+		Window:      time.Hour,
+		Duration:    time.Second,
+		Attributes:  []string{"user=vip"},
+		Probability: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	e := &tailSamplerTestExporter{}
+	failed, slow, vip, fast := NewTraceID(), NewTraceID(), NewTraceID(), NewTraceID()
+
+	e.add(s, failed, "failed-child", time.Millisecond, false, nil)
+	e.add(s, failed, "failed-root", time.Millisecond, true, nil)
+	e.add(s, slow, "slow", 2*time.Second, false, nil)
+	e.add(s, vip, "vip", time.Millisecond, false, map[string]interface{}{"user": "vip"})
+	e.add(s, fast, "fast", time.Millisecond, false, map[string]interface{}{"user": "guest"})
+
+	if e.exported() != "" {
+		t.Fatalf("Spans are exported before decision: %s", e.exported())
+	}
+
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if e.exported() != "failed-child,failed-root,slow,vip" {
+		t.Fatalf("Wrong exported spans: %s", e.exported())
+	}
+
+	// late spans follow decision on their trace
+	e.add(s, failed, "failed-late", time.Millisecond, false, nil)
+	e.add(s, fast, "fast-late", time.Millisecond, true, nil)
+	if e.exported() != "failed-child,failed-late,failed-root,slow,vip" {
+		t.Fatalf("Late spans don't follow decision: %s", e.exported())
+	}
+}
+
+func TestTailSamplerWindow(t *testing.T) {
+
+	s, err := NewTailSampler(TailSamplerOptions{Window: 50 * time.Millisecond, Probability: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &tailSamplerTestExporter{}
+	e.add(s, NewTraceID(), "span", time.Millisecond, false, nil)
+
+	for i := 0; i < 50 && e.exported() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e.exported() != "span" {
+		t.Fatal("Span is not exported after window")
+	}
+
+	// spans are not held after shutdown
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e.add(s, NewTraceID(), "stopped", time.Millisecond, false, nil)
+	if e.exported() != "span,stopped" {
+		t.Fatalf("Span is held after shutdown: %s", e.exported())
+	}
+}
+
+func TestTailSamplerWrongOptions(t *testing.T) {
+
+	if _, err := NewTailSampler(TailSamplerOptions{Probability: 2}); err == nil {
+		t.Fatal("Wrong probability is accepted")
+	}
+	if _, err := NewTailSampler(TailSamplerOptions{Attributes: []string{"=vip"}}); err == nil {
+		t.Fatal("Wrong attribute is accepted")
+	}
+}
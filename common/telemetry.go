@@ -0,0 +1,197 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TelemetryLogs    = "logs"
+	TelemetryMetrics = "metrics"
+	TelemetryTraces  = "traces"
+	TelemetryEvents  = "events"
+)
+
+const telemetryPrefix = "telemetry"
+
+// Telemetry records metrics about the framework's own pipelines
+// (queued, sent, dropped, failed, rejected records, export latency and queue depth)
+// into a meter, usually the one the application registers its meters in
+type Telemetry struct {
+	meter      Meter
+	counters   sync.Map
+	gauges     sync.Map
+	histograms sync.Map
+}
+
+var telemetry atomic.Pointer[Telemetry]
+
+func telemetryKey(name string, labels Labels) string {
+
+	return strings.Join([]string{name, labels["provider"], labels["signal"], labels["status"], labels["metric"]}, "/")
+}
+
+func telemetryLabels(provider, signal string) Labels {
+
+	return Labels{
+		"provider": provider,
+		"signal":   signal,
+	}
+}
+
+// telemetryUnlimited is implemented by meters which limit series of application metrics
+type telemetryUnlimited interface {
+	unlimited() Meter
+}
+
+func (t *Telemetry) target() Meter {
+
+	if u, ok := t.meter.(telemetryUnlimited); ok {
+		return u.unlimited()
+	}
+	return t.meter
+}
+
+func (t *Telemetry) counter(name, description string, labels Labels) Counter {
+
+	key := telemetryKey(name, labels)
+	c, ok := t.counters.Load(key)
+	if ok {
+		return c.(Counter)
+	}
+
+	counter := t.target().Counter("", name, description, labels, telemetryPrefix)
+	if counter == nil {
+		return nil
+	}
+	c, _ = t.counters.LoadOrStore(key, counter)
+	return c.(Counter)
+}
+
+func (t *Telemetry) gauge(name, description string, labels Labels) Gauge {
+
+	key := telemetryKey(name, labels)
+	g, ok := t.gauges.Load(key)
+	if ok {
+		return g.(Gauge)
+	}
+
+	gauge := t.target().Gauge("", name, description, labels, telemetryPrefix)
+	if gauge == nil {
+		return nil
+	}
+	g, _ = t.gauges.LoadOrStore(key, gauge)
+	return g.(Gauge)
+}
+
+func (t *Telemetry) histogram(name, description string, labels Labels) Histogram {
+
+	key := telemetryKey(name, labels)
+	h, ok := t.histograms.Load(key)
+	if ok {
+		return h.(Histogram)
+	}
+
+	histogram := t.target().Histogram("", name, description, labels, telemetryPrefix)
+	if histogram == nil {
+		return nil
+	}
+	h, _ = t.histograms.LoadOrStore(key, histogram)
+	return h.(Histogram)
+}
+
+func (t *Telemetry) add(name, description, provider, signal string, count int) {
+
+	if t == nil || t.meter == nil || count <= 0 {
+		return
+	}
+
+	counter := t.counter(name, description, telemetryLabels(provider, signal))
+	if counter != nil {
+		counter.Add(count)
+	}
+}
+
+func (t *Telemetry) Queued(provider, signal string, count int) {
+	t.add("records_queued", "Records accepted by provider", provider, signal, count)
+}
+
+func (t *Telemetry) Sent(provider, signal string, count int) {
+	t.add("records_sent", "Records delivered by provider", provider, signal, count)
+}
+
+func (t *Telemetry) Dropped(provider, signal string, count int) {
+	t.add("records_dropped", "Records dropped by provider", provider, signal, count)
+}
+
+func (t *Telemetry) Failed(provider, signal string, count int) {
+	t.add("records_failed", "Records failed to be delivered by provider", provider, signal, count)
+}
+
+func (t *Telemetry) Rejected(provider, signal string, count int) {
+	t.add("records_rejected", "Records rejected by provider as invalid", provider, signal, count)
+}
+
+func (t *Telemetry) Export(provider, signal string, started time.Time, err error) {
+
+	if t == nil || t.meter == nil {
+		return
+	}
+
+	labels := telemetryLabels(provider, signal)
+	histogram := t.histogram("export_latency_seconds", "Export latency of provider", labels)
+	if histogram != nil {
+		histogram.Observe(time.Since(started).Seconds())
+	}
+
+	labels = telemetryLabels(provider, signal)
+	labels["status"] = "ok"
+	if err != nil {
+		labels["status"] = "error"
+	}
+	counter := t.counter("exports", "Exports made by provider", labels)
+	if counter != nil {
+		counter.Inc()
+	}
+}
+
+func (t *Telemetry) Overflowed(metric string, count int) {
+
+	if t == nil || t.meter == nil || count <= 0 {
+		return
+	}
+
+	counter := t.counter("series_overflowed", "Series moved to overflow by cardinality limit", Labels{"metric": metric})
+	if counter != nil {
+		counter.Add(count)
+	}
+}
+
+func (t *Telemetry) QueueDepth(provider, signal string, depth int) {
+
+	if t == nil || t.meter == nil {
+		return
+	}
+
+	gauge := t.gauge("queue_depth", "Records waiting to be delivered by provider", telemetryLabels(provider, signal))
+	if gauge != nil {
+		gauge.Set(float64(depth))
+	}
+}
+
+func SetTelemetry(t *Telemetry) {
+	telemetry.Store(t)
+}
+
+func GetTelemetry() *Telemetry {
+	return telemetry.Load()
+}
+
+func NewTelemetry(meter Meter) *Telemetry {
+
+	return &Telemetry{
+		meter: meter,
+	}
+}
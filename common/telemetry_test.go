@@ -0,0 +1,144 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// telemetryTestMeter implements only what Telemetry and Metrics tests use, the rest panics by nil interfaces
+type telemetryTestMeter struct {
+	Meter
+	values map[string]float64
+}
+
+type telemetryTestMetric struct {
+	Counter
+	meter *telemetryTestMeter
+	key   string
+}
+
+type telemetryTestGauge struct {
+	Gauge
+	metric *telemetryTestMetric
+}
+
+type telemetryTestHistogram struct {
+	Histogram
+	metric *telemetryTestMetric
+}
+
+func (m *telemetryTestMetric) Inc() Counter {
+	return m.Add(1)
+}
+
+func (m *telemetryTestMetric) Add(value int) Counter {
+	m.meter.values[m.key] += float64(value)
+	return m
+}
+
+func (g *telemetryTestGauge) Set(value float64) Gauge {
+	g.metric.meter.values[g.metric.key] = value
+	return g
+}
+
+func (g *telemetryTestGauge) Add(value float64) Gauge {
+	g.metric.meter.values[g.metric.key] += value
+	return g
+}
+
+func (g *telemetryTestGauge) Sub(value float64) Gauge {
+	return g.Add(-value)
+}
+
+func (g *telemetryTestGauge) Inc() Gauge {
+	return g.Add(1)
+}
+
+func (g *telemetryTestGauge) Dec() Gauge {
+	return g.Add(-1)
+}
+
+func (h *telemetryTestHistogram) Observe(value float64) Histogram {
+	h.metric.Inc()
+	return h
+}
+
+func (tm *telemetryTestMeter) metric(name string, labels Labels, prefixes ...string) *telemetryTestMetric {
+
+	var arr []string
+	for k, v := range labels {
+		arr = append(arr, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(arr)
+	names := append(prefixes, name)
+	return &telemetryTestMetric{
+		meter: tm,
+		key:   fmt.Sprintf("%s{%s}", strings.Join(names, "_"), strings.Join(arr, ",")),
+	}
+}
+
+func (tm *telemetryTestMeter) Counter(group, name, description string, labels Labels, prefixes ...string) Counter {
+	return tm.metric(name, labels, prefixes...)
+}
+
+func (tm *telemetryTestMeter) Gauge(group, name, description string, labels Labels, prefixes ...string) Gauge {
+	return &telemetryTestGauge{metric: tm.metric(name, labels, prefixes...)}
+}
+
+func (tm *telemetryTestMeter) ObservableGauge(group, name, description string, labels Labels, callback func() float64, prefixes ...string) {
+	tm.values[tm.metric(name, labels, prefixes...).key] = callback()
+}
+
+func (tm *telemetryTestMeter) Histogram(group, name, description string, labels Labels, prefixes ...string) Histogram {
+	return &telemetryTestHistogram{metric: tm.metric(name, labels, prefixes...)}
+}
+
+func TestTelemetry(t *testing.T) {
+
+	meter := &telemetryTestMeter{values: make(map[string]float64)}
+	telemetry := NewTelemetry(meter)
+
+	telemetry.Queued("newrelic", TelemetryLogs, 3)
+	telemetry.Sent("newrelic", TelemetryLogs, 2)
+	telemetry.Sent("newrelic", TelemetryLogs, 1)
+	telemetry.Dropped("datadog", TelemetryLogs, 1)
+	telemetry.Failed("grafana", TelemetryEvents, 1)
+	telemetry.Rejected("prometheus", TelemetryMetrics, 2)
+	telemetry.QueueDepth("datadog", TelemetryLogs, 7)
+	telemetry.Export("grafana", TelemetryEvents, time.Now(), nil)
+	telemetry.Export("grafana", TelemetryEvents, time.Now(), errors.New("some error"))
+
+	expected := map[string]float64{
+		"telemetry_records_queued{provider=newrelic,signal=logs}":          3,
+		"telemetry_records_sent{provider=newrelic,signal=logs}":            3,
+		"telemetry_records_dropped{provider=datadog,signal=logs}":          1,
+		"telemetry_records_failed{provider=grafana,signal=events}":         1,
+		"telemetry_records_rejected{provider=prometheus,signal=metrics}":   2,
+		"telemetry_queue_depth{provider=datadog,signal=logs}":              7,
+		"telemetry_export_latency_seconds{provider=grafana,signal=events}": 2,
+		"telemetry_exports{provider=grafana,signal=events,status=ok}":      1,
+		"telemetry_exports{provider=grafana,signal=events,status=error}":   1,
+	}
+
+	for k, v := range expected {
+		if meter.values[k] != v {
+			t.Fatalf("Invalid value %v of %s, expected %v", meter.values[k], k, v)
+		}
+	}
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+
+	var telemetry *Telemetry
+	telemetry.Queued("newrelic", TelemetryLogs, 1)
+	telemetry.Export("newrelic", TelemetryLogs, time.Now(), nil)
+	telemetry.QueueDepth("newrelic", TelemetryLogs, 1)
+
+	if GetTelemetry() != nil {
+		t.Fatal("Telemetry is enabled by default")
+	}
+}
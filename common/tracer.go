@@ -1,5 +1,10 @@
 package common
 
+import (
+	"context"
+	"time"
+)
+
 type TracerSpanContext interface {
 	GetTraceID() string
 	GetSpanID() string
@@ -21,4 +26,12 @@ type Tracer interface {
 	StartChildSpan(object interface{}) TracerSpan
 	StartFollowSpan(object interface{}) TracerSpan
 	Stop()
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// TimedTracer is implemented by tracers which can start span at given time,
+// root spans waiting for name to be sampled are started by them later than they are created
+type TimedTracer interface {
+	StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) TracerSpan
 }
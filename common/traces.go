@@ -1,6 +1,10 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	utils "github.com/devopsext/utils"
 )
 
@@ -15,10 +19,16 @@ type TracesSpan struct {
 	spanID      string
 	spanContext *TracesSpanContext
 	traces      *Traces
+	started     time.Time
+	pending     bool // root span waits for name to be sampled by operation rules
+	dropped     bool
 }
 
 type Traces struct {
-	tracers []Tracer
+	tracers  []Tracer
+	redactor *Redactor
+	sampler  *Sampler
+	tail     *TailSampler
 }
 
 func (tssc TracesSpanContext) GetTraceID() string {
@@ -37,8 +47,40 @@ func (tssc TracesSpanContext) GetSpanID() string {
 	return tssc.span.spanID
 }
 
+// start starts spans of tracers for pending root span if sampler keeps it
+func (tss *TracesSpan) start(name string) {
+
+	tss.pending = false
+	if !tss.traces.sampler.Sample(tss.traceID, name) {
+		tss.dropped = true
+		return
+	}
+
+	for _, t := range tss.traces.tracers {
+
+		var s TracerSpan
+		// span is started when it was created, not when it got name
+		if tt, ok := t.(TimedTracer); ok {
+			s = tt.StartSpanWithTraceIDAt(tss.traceID, tss.spanID, tss.started)
+		} else {
+			s = t.StartSpanWithTraceID(tss.traceID, tss.spanID)
+		}
+		if s != nil {
+			tss.spans[t] = s
+		}
+	}
+}
+
+func (tss *TracesSpan) resolve() {
+	if tss.pending {
+		tss.start("")
+	}
+}
+
 func (tss *TracesSpan) GetContext() TracerSpanContext {
 
+	tss.resolve()
+
 	if tss.spanContext != nil {
 		return tss.spanContext
 	}
@@ -61,6 +103,8 @@ func (tss *TracesSpan) GetContext() TracerSpanContext {
 
 func (tss *TracesSpan) SetCarrier(object interface{}) TracerSpan {
 
+	tss.resolve()
+
 	for _, s := range tss.spans {
 		s.SetCarrier(object)
 	}
@@ -69,6 +113,10 @@ func (tss *TracesSpan) SetCarrier(object interface{}) TracerSpan {
 
 func (tss *TracesSpan) SetName(name string) TracerSpan {
 
+	if tss.pending {
+		tss.start(name)
+	}
+
 	for _, s := range tss.spans {
 		s.SetName(name)
 	}
@@ -77,6 +125,10 @@ func (tss *TracesSpan) SetName(name string) TracerSpan {
 
 func (tss *TracesSpan) SetTag(key string, value interface{}) TracerSpan {
 
+	tss.resolve()
+
+	value = tss.traces.redactor.Field(key, value)
+
 	for _, s := range tss.spans {
 		s.SetTag(key, value)
 	}
@@ -85,6 +137,12 @@ func (tss *TracesSpan) SetTag(key string, value interface{}) TracerSpan {
 
 func (tss *TracesSpan) SetBaggageItem(restrictedKey, value string) TracerSpan {
 
+	tss.resolve()
+
+	if v, ok := tss.traces.redactor.Field(restrictedKey, value).(string); ok {
+		value = v
+	}
+
 	for _, s := range tss.spans {
 		s.SetBaggageItem(restrictedKey, value)
 	}
@@ -93,6 +151,12 @@ func (tss *TracesSpan) SetBaggageItem(restrictedKey, value string) TracerSpan {
 
 func (tss *TracesSpan) Error(err error) TracerSpan {
 
+	tss.resolve()
+
+	if err != nil && tss.traces.redactor != nil {
+		err = errors.New(tss.traces.redactor.String(err.Error()))
+	}
+
 	for _, s := range tss.spans {
 		s.Error(err)
 	}
@@ -100,15 +164,74 @@ func (tss *TracesSpan) Error(err error) TracerSpan {
 }
 
 func (tss *TracesSpan) Finish() {
+
+	tss.resolve()
 	for _, s := range tss.spans {
 		s.Finish()
 	}
 }
 
+func (ts *Traces) SetRedactor(r *Redactor) {
+	ts.redactor = r
+}
+
+// SetSampler makes traces keep or drop whole trace by root span, child spans follow decision of parent,
+// root spans are started by tracers only when they get name, if sampler has operation rules
+func (ts *Traces) SetSampler(s *Sampler) {
+
+	ts.sampler = s
+	for _, t := range ts.tracers {
+		if st, ok := t.(SampledTracer); ok {
+			st.SetSampler(s)
+		}
+	}
+}
+
+// sample decides on root span, it is false if span is dropped or pending
+func (ts *Traces) sample(span *TracesSpan) bool {
+
+	if ts.sampler.hasOperations() {
+		span.pending = true
+		return false
+	}
+	span.dropped = !ts.sampler.Sample(span.traceID, "")
+	return !span.dropped
+}
+
+// sampleRemote samples child of remote parent if sampler doesn't keep decision of parent
+func (ts *Traces) sampleRemote(span *TracesSpan) {
+
+	if len(span.spans) == 0 || ts.sampler.parentBased() || ts.sampler.Sample(span.traceID, "") {
+		return
+	}
+	span.spans = make(map[Tracer]TracerSpan)
+	span.dropped = true
+}
+
+// SetTailSampler makes tracers which send span data from this process hold finished spans
+// until their trace is kept or dropped by tail sampler
+func (ts *Traces) SetTailSampler(s *TailSampler) {
+
+	ts.tail = s
+	for _, t := range ts.tracers {
+		if tst, ok := t.(TailSampledTracer); ok {
+			tst.SetTailSampler(s)
+		}
+	}
+}
+
 func (ts *Traces) Register(t Tracer) {
-	if t != nil {
-		ts.tracers = append(ts.tracers, t)
+
+	if t == nil {
+		return
+	}
+	if st, ok := t.(SampledTracer); ok && ts.sampler != nil {
+		st.SetSampler(ts.sampler)
 	}
+	if tst, ok := t.(TailSampledTracer); ok && ts.tail != nil {
+		tst.SetTailSampler(ts.tail)
+	}
+	ts.tracers = append(ts.tracers, t)
 }
 
 func (ts *Traces) StartSpan() TracerSpan {
@@ -121,6 +244,11 @@ func (ts *Traces) StartSpan() TracerSpan {
 		spans:   make(map[Tracer]TracerSpan),
 		traceID: traceID,
 		spanID:  spanID,
+		started: time.Now(),
+	}
+
+	if !ts.sample(&span) {
+		return &span
 	}
 
 	for _, t := range ts.tracers {
@@ -148,6 +276,11 @@ func (ts *Traces) StartSpanWithTraceID(traceID, spanID string) TracerSpan {
 		spans:   make(map[Tracer]TracerSpan),
 		traceID: traceID,
 		spanID:  spanID,
+		started: time.Now(),
+	}
+
+	if !ts.sample(&span) {
+		return &span
 	}
 
 	for _, t := range ts.tracers {
@@ -178,6 +311,11 @@ func (ts *Traces) StartChildSpan(object interface{}) TracerSpan {
 		spanID:  spanID,
 	}
 
+	if spanCtxOk && spanCtx.span != nil && spanCtx.span.dropped {
+		span.dropped = true
+		return &span
+	}
+
 	for _, t := range ts.tracers {
 
 		var s TracerSpan
@@ -203,6 +341,9 @@ func (ts *Traces) StartChildSpan(object interface{}) TracerSpan {
 			}
 		}
 	}
+	if !spanCtxOk {
+		ts.sampleRemote(&span)
+	}
 	return &span
 }
 
@@ -224,6 +365,11 @@ func (ts *Traces) StartFollowSpan(object interface{}) TracerSpan {
 		spanID:  spanID,
 	}
 
+	if spanCtxOk && spanCtx.span != nil && spanCtx.span.dropped {
+		span.dropped = true
+		return &span
+	}
+
 	for _, t := range ts.tracers {
 
 		var s TracerSpan
@@ -249,16 +395,40 @@ func (ts *Traces) StartFollowSpan(object interface{}) TracerSpan {
 			}
 		}
 	}
+	if !spanCtxOk {
+		ts.sampleRemote(&span)
+	}
 	return &span
 }
 
 func (ts *Traces) Stop() {
 
+	ts.tail.Shutdown(context.Background())
 	for _, t := range ts.tracers {
 		t.Stop()
 	}
 }
 
+func (ts *Traces) exporters() []exporter {
+
+	var items []exporter
+	for _, t := range ts.tracers {
+		items = append(items, t)
+	}
+	return items
+}
+
+// Flush asks tracers to send what they have buffered without stopping them,
+// spans held by tail sampler are decided first
+func (ts *Traces) Flush(ctx context.Context) error {
+	return errors.Join(ts.tail.Flush(ctx), flush(ctx, ts.exporters()))
+}
+
+// Shutdown stops tail sampler and then tracers in parallel, ctx limits time to deliver buffered spans
+func (ts *Traces) Shutdown(ctx context.Context) error {
+	return errors.Join(ts.tail.Shutdown(ctx), shutdown(ctx, ts.exporters()))
+}
+
 func NewTraces() *Traces {
 
 	ts := Traces{}
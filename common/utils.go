@@ -1,7 +1,9 @@
 package common
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -78,3 +80,37 @@ func NewTraceID() string {
 func NewSpanID() string {
 	return SpanIDUint64ToHex(randomNumber())
 }
+
+type exporter interface {
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// parallel calls fn for all providers at once, errors are prefixed by provider type
+func parallel(items []exporter, fn func(e exporter) error) error {
+
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+
+		wg.Add(1)
+		go func(i int, item exporter) {
+
+			defer wg.Done()
+			if err := fn(item); err != nil {
+				errs[i] = fmt.Errorf("%T: %w", item, err)
+			}
+		}(i, item)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func flush(ctx context.Context, items []exporter) error {
+	return parallel(items, func(e exporter) error { return e.Flush(ctx) })
+}
+
+func shutdown(ctx context.Context, items []exporter) error {
+	return parallel(items, func(e exporter) error { return e.Shutdown(ctx) })
+}
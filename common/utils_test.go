@@ -1,8 +1,12 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUtilsTraceID(t *testing.T) {
@@ -90,3 +94,46 @@ func TestUtilsSpanID(t *testing.T) {
 		t.Fatal("Wrong trace ID hex")
 	}
 }
+
+type utilsTestShutdowner struct {
+	delay time.Duration
+	err   error
+	done  bool
+}
+
+func (s *utilsTestShutdowner) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *utilsTestShutdowner) Shutdown(ctx context.Context) error {
+
+	select {
+	case <-time.After(s.delay):
+		s.done = true
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestUtilsShutdown(t *testing.T) {
+
+	fast := &utilsTestShutdowner{}
+	failed := &utilsTestShutdowner{err: errors.New("failed")}
+	slow := &utilsTestShutdowner{delay: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	err := shutdown(ctx, []exporter{fast, failed, slow})
+	if err == nil || !fast.done || slow.done {
+		t.Fatalf("Wrong shutdown: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "*common.utilsTestShutdowner: failed") {
+		t.Fatalf("Wrong shutdown errors: %v", err)
+	}
+
+	if err := shutdown(context.Background(), []exporter{fast}); err != nil {
+		t.Fatal(err)
+	}
+}
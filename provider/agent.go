@@ -0,0 +1,290 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devopsext/sre/common"
+)
+
+const (
+	AgentWriterDefaultBufferSize = 1000
+	agentWriterTimeout           = time.Second * 5
+	agentWriterMinBackoff        = time.Millisecond * 100
+	agentWriterMaxBackoff        = time.Second * 30
+)
+
+type AgentWriterOptions struct {
+	Network    string
+	Host       string
+	Port       int
+	BufferSize int
+	Provider   string
+	Signal     string
+}
+
+type AgentWriterStats struct {
+	Sent     uint64
+	Dropped  uint64
+	Buffered int
+	Connects uint64
+}
+
+// AgentWriter is io.Writer to a local agent which connects lazily,
+// reconnects with backoff and keeps messages in memory while disconnected
+type AgentWriter struct {
+	options    AgentWriterOptions
+	address    string
+	connection net.Conn
+	buffer     [][]byte
+	mutex      sync.Mutex
+	sending    sync.Mutex
+	pending    chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+	sent       uint64
+	dropped    uint64
+	connects   uint64
+}
+
+func (aw *AgentWriter) push(p []byte) int {
+
+	dropped := 0
+	if len(aw.buffer) >= aw.options.BufferSize {
+		// drop the oldest message to keep the latest ones
+		aw.buffer = aw.buffer[1:]
+		dropped = 1
+	}
+
+	b := make([]byte, len(p))
+	copy(b, p)
+	aw.buffer = append(aw.buffer, b)
+	return dropped
+}
+
+// take moves buffered messages out, so they are written without the lock
+func (aw *AgentWriter) take() [][]byte {
+
+	aw.mutex.Lock()
+	defer aw.mutex.Unlock()
+
+	items := aw.buffer
+	aw.buffer = nil
+	return items
+}
+
+// restore puts unsent messages back in front of the ones buffered meanwhile
+func (aw *AgentWriter) restore(items [][]byte) (int, int) {
+
+	aw.mutex.Lock()
+	defer aw.mutex.Unlock()
+
+	aw.buffer = append(items, aw.buffer...)
+	dropped := 0
+	if len(aw.buffer) > aw.options.BufferSize {
+		dropped = len(aw.buffer) - aw.options.BufferSize
+		aw.buffer = aw.buffer[dropped:]
+	}
+	return dropped, len(aw.buffer)
+}
+
+func (aw *AgentWriter) depth() int {
+
+	aw.mutex.Lock()
+	defer aw.mutex.Unlock()
+	return len(aw.buffer)
+}
+
+// report is called outside of the lock as telemetry might log through this writer
+func (aw *AgentWriter) report(sent, dropped, depth int) {
+
+	atomic.AddUint64(&aw.sent, uint64(sent))
+	atomic.AddUint64(&aw.dropped, uint64(dropped))
+
+	t := common.GetTelemetry()
+	t.Sent(aw.options.Provider, aw.options.Signal, sent)
+	t.Dropped(aw.options.Provider, aw.options.Signal, dropped)
+	t.QueueDepth(aw.options.Provider, aw.options.Signal, depth)
+}
+
+func (aw *AgentWriter) signal() {
+
+	select {
+	case aw.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (aw *AgentWriter) disconnect() {
+
+	if aw.connection != nil {
+		aw.connection.Close()
+		aw.connection = nil
+	}
+}
+
+func (aw *AgentWriter) write(p []byte) error {
+
+	aw.connection.SetWriteDeadline(time.Now().Add(agentWriterTimeout))
+	_, err := aw.connection.Write(p)
+	return err
+}
+
+// send writes buffered messages in order, it's called under sending lock with connection
+func (aw *AgentWriter) send() bool {
+
+	for {
+		items := aw.take()
+		if len(items) == 0 {
+			return true
+		}
+
+		for i, p := range items {
+			if err := aw.write(p); err != nil {
+				aw.disconnect()
+				dropped, depth := aw.restore(items[i:])
+				aw.report(i, dropped, depth)
+				return false
+			}
+		}
+		aw.report(len(items), 0, aw.depth())
+	}
+}
+
+// deliver connects if needed and sends buffered messages, network is used by one caller at a time
+func (aw *AgentWriter) deliver() bool {
+
+	aw.sending.Lock()
+	defer aw.sending.Unlock()
+
+	if aw.connection == nil {
+
+		connection, err := net.DialTimeout(aw.options.Network, aw.address, agentWriterTimeout)
+		if err != nil {
+			return false
+		}
+		aw.connection = connection
+		atomic.AddUint64(&aw.connects, 1)
+	}
+	return aw.send()
+}
+
+// Write only buffers message, it's sent by background goroutine, so loggers are not blocked by network
+func (aw *AgentWriter) Write(p []byte) (int, error) {
+
+	aw.mutex.Lock()
+	dropped := aw.push(p)
+	depth := len(aw.buffer)
+	aw.mutex.Unlock()
+
+	aw.signal()
+	aw.report(0, dropped, depth)
+	return len(p), nil
+}
+
+func (aw *AgentWriter) run() {
+
+	defer aw.wg.Done()
+
+	for {
+		select {
+		case <-aw.stop:
+			return
+		case <-aw.pending:
+		}
+
+		backoff := agentWriterMinBackoff
+		for !aw.deliver() {
+			select {
+			case <-aw.stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = backoff * 2
+			if backoff > agentWriterMaxBackoff {
+				backoff = agentWriterMaxBackoff
+			}
+		}
+	}
+}
+
+func (aw *AgentWriter) Stats() AgentWriterStats {
+
+	return AgentWriterStats{
+		Sent:     atomic.LoadUint64(&aw.sent),
+		Dropped:  atomic.LoadUint64(&aw.dropped),
+		Buffered: aw.depth(),
+		Connects: atomic.LoadUint64(&aw.connects),
+	}
+}
+
+// Flush tries to connect and send buffered messages now, instead of waiting for reconnect
+func (aw *AgentWriter) Flush(ctx context.Context) error {
+
+	select {
+	case <-aw.stop:
+		return nil
+	default:
+	}
+
+	return waitContext(ctx, func() error {
+
+		if aw.deliver() {
+			return nil
+		}
+
+		depth := aw.depth()
+		if depth == 0 {
+			return nil
+		}
+		return fmt.Errorf("agent %s is unavailable, %d messages are buffered", aw.address, depth)
+	})
+}
+
+func (aw *AgentWriter) Close() error {
+
+	closed := false
+	aw.stopOnce.Do(func() {
+		close(aw.stop)
+		closed = true
+	})
+	if !closed {
+		return nil
+	}
+	aw.wg.Wait()
+
+	aw.sending.Lock()
+	if aw.connection != nil {
+		aw.send()
+	}
+	aw.disconnect()
+	aw.sending.Unlock()
+
+	aw.report(0, len(aw.take()), 0)
+	return nil
+}
+
+func NewAgentWriter(options AgentWriterOptions) *AgentWriter {
+
+	if options.BufferSize <= 0 {
+		options.BufferSize = AgentWriterDefaultBufferSize
+	}
+
+	aw := &AgentWriter{
+		options: options,
+		address: net.JoinHostPort(options.Host, strconv.Itoa(options.Port)),
+		pending: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+
+	aw.wg.Add(1)
+	go aw.run()
+	aw.signal()
+	return aw
+}
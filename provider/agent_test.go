@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func agentFreePort(t *testing.T) int {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestAgentWriterLazyConnect(t *testing.T) {
+
+	port := agentFreePort(t)
+
+	writer := NewAgentWriter(AgentWriterOptions{
+		Network:    "tcp",
+		Host:       "127.0.0.1",
+		Port:       port,
+		BufferSize: 10,
+	})
+	defer writer.Close()
+
+	// agent is not up yet, messages should be kept in buffer
+	for i := 0; i < 3; i++ {
+		if _, err := writer.Write([]byte("message\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := writer.Stats()
+	if stats.Buffered != 3 || stats.Sent != 0 {
+		t.Fatalf("Invalid stats %+v", stats)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-lines:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Buffered message %d is not delivered", i)
+		}
+	}
+
+	stats = writer.Stats()
+	if stats.Buffered != 0 || stats.Sent != 3 || stats.Connects != 1 {
+		t.Fatalf("Invalid stats %+v", stats)
+	}
+}
+
+func TestAgentWriterBufferLimit(t *testing.T) {
+
+	writer := NewAgentWriter(AgentWriterOptions{
+		Network:    "tcp",
+		Host:       "127.0.0.1",
+		Port:       agentFreePort(t),
+		BufferSize: 2,
+	})
+
+	for i := 0; i < 5; i++ {
+		writer.Write([]byte("message\n"))
+	}
+
+	stats := writer.Stats()
+	if stats.Buffered != 2 || stats.Dropped != 3 {
+		t.Fatalf("Invalid stats %+v", stats)
+	}
+
+	writer.Close()
+
+	stats = writer.Stats()
+	if stats.Buffered != 0 || stats.Dropped != 5 {
+		t.Fatalf("Invalid stats after close %+v", stats)
+	}
+}
+
+func TestAgentWriterFlush(t *testing.T) {
+
+	port := agentFreePort(t)
+
+	writer := NewAgentWriter(AgentWriterOptions{
+		Network:    "tcp",
+		Host:       "127.0.0.1",
+		Port:       port,
+		BufferSize: 10,
+	})
+	defer writer.Close()
+
+	writer.Write([]byte("message\n"))
+	if err := writer.Flush(context.Background()); err == nil {
+		t.Fatal("Flush to unavailable agent is succeeded")
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := writer.Stats(); stats.Buffered != 0 || stats.Sent != 1 {
+		t.Fatalf("Invalid stats %+v", stats)
+	}
+}
+
+func TestAgentWriterOrder(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	writer := NewAgentWriter(AgentWriterOptions{
+		Network:    "tcp",
+		Host:       "127.0.0.1",
+		Port:       listener.Addr().(*net.TCPAddr).Port,
+		BufferSize: 100,
+	})
+	defer writer.Close()
+
+	// messages written while older ones are being sent keep their order
+	for i := 0; i < 50; i++ {
+		writer.Write([]byte(strconv.Itoa(i) + "\n"))
+	}
+
+	for i := 0; i < 50; i++ {
+		select {
+		case line := <-lines:
+			if line != strconv.Itoa(i) {
+				t.Fatalf("Message %s is received instead of %d", line, i)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Message %d is not delivered", i)
+		}
+	}
+}
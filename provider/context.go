@@ -0,0 +1,19 @@
+package provider
+
+import "context"
+
+// waitContext waits for fn until ctx is done, fn keeps running in background after that
+func waitContext(ctx context.Context, fn func() error) error {
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
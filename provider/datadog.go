@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	ddClient "github.com/DataDog/datadog-api-client-go/api/v1/datadog"
@@ -17,6 +20,7 @@ import (
 	utils "github.com/devopsext/utils"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -37,9 +41,10 @@ type DataDogTracerOptions struct {
 
 type DataDogLoggerOptions struct {
 	DataDogOptions
-	AgentHost string
-	AgentPort int
-	Level     string
+	AgentHost  string
+	AgentPort  int
+	Level      string
+	BufferSize int
 }
 
 type DataDogMeterOptions struct {
@@ -73,10 +78,11 @@ type DataDogTracer struct {
 	options      DataDogTracerOptions
 	logger       common.Logger
 	callerOffset int
+	sampled      bool
 }
 
 type DataDogLogger struct {
-	connection   *net.UDPConn
+	connection   *AgentWriter
 	stdout       *Stdout
 	log          *logrus.Logger
 	options      DataDogLoggerOptions
@@ -87,14 +93,38 @@ type DataDogCounter struct {
 	meter       *DataDogMeter
 	name        string
 	description string
-	labels      []string
+	tags        []string
+}
+
+type DataDogFloatCounter struct {
+	meter       *DataDogMeter
+	name        string
+	description string
+	tags        []string
+	mutex       sync.Mutex
+	remainder   float64
 }
 
 type DataDogGauge struct {
 	meter       *DataDogMeter
 	name        string
 	description string
-	labels      []string
+	tags        []string
+	value       MeterGaugeValue
+}
+
+type DataDogHistogram struct {
+	meter       *DataDogMeter
+	name        string
+	description string
+	tags        []string
+}
+
+type DataDogSummary struct {
+	meter       *DataDogMeter
+	name        string
+	description string
+	tags        []string
 }
 
 type DataDogMeter struct {
@@ -102,6 +132,14 @@ type DataDogMeter struct {
 	logger       common.Logger
 	callerOffset int
 	client       *statsd.Client
+	gauges       *sync.Map
+	observables  *sync.Map
+	observer     *MeterObserver
+}
+
+// DataDogTracerTransport counts traces sent to agent, payload has number of traces in header
+type DataDogTracerTransport struct {
+	next http.RoundTripper
 }
 
 type DataDogEventer struct {
@@ -112,6 +150,34 @@ type DataDogEventer struct {
 	tags    []string
 }
 
+const dataDogTraceCountHeader = "X-Datadog-Trace-Count"
+
+func (ddtt *DataDogTracerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	// other requests to agent, like info, have no traces
+	traces, _ := strconv.Atoi(req.Header.Get(dataDogTraceCountHeader))
+	if traces <= 0 {
+		return ddtt.next.RoundTrip(req)
+	}
+
+	started := time.Now()
+	resp, err := ddtt.next.RoundTrip(req)
+
+	exportErr := err
+	if err == nil && resp.StatusCode >= 400 {
+		exportErr = fmt.Errorf("HTTP error %d", resp.StatusCode)
+	}
+
+	t := common.GetTelemetry()
+	t.Export("datadog", common.TelemetryTraces, started, exportErr)
+	if exportErr != nil {
+		t.Failed("datadog", common.TelemetryTraces, traces)
+	} else {
+		t.Sent("datadog", common.TelemetryTraces, traces)
+	}
+	return resp, err
+}
+
 func (ddsc *DataDogTracerSpanContext) GetTraceID() string {
 
 	if ddsc.context == nil {
@@ -240,6 +306,15 @@ func (dd *DataDogTracer) StartSpan() common.TracerSpan {
 }
 
 func (dd *DataDogTracer) StartSpanWithTraceID(traceID, spanID string) common.TracerSpan {
+	return dd.startSpanWithTraceID(traceID, spanID, time.Now())
+}
+
+// StartSpanWithTraceIDAt starts span at time when it was created by traces
+func (dd *DataDogTracer) StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) common.TracerSpan {
+	return dd.startSpanWithTraceID(traceID, spanID, started)
+}
+
+func (dd *DataDogTracer) startSpanWithTraceID(traceID, spanID string, started time.Time) common.TracerSpan {
 
 	tID := common.TraceIDHexToUint64(traceID)
 	if tID == 0 {
@@ -256,14 +331,19 @@ func (dd *DataDogTracer) StartSpanWithTraceID(traceID, spanID string) common.Tra
 		tracer.DefaultTraceIDHeader:  strconv.FormatUint(tID, 10),
 		tracer.DefaultParentIDHeader: strconv.FormatUint(sID, 10),
 	}
+	// trace is kept by sampler of traces, so agent must not drop it
+	if dd.sampled {
+		carrier[tracer.DefaultPriorityHeader] = strconv.Itoa(ext.PriorityUserKeep)
+	}
 	parentCtx, err := tracer.Extract(carrier)
 	if err != nil {
 		dd.logger.Error(err)
 		return nil
 	}
 
-	s, ctx := dd.startSpanFromContext(context.Background(), dd.callerOffset+4,
+	s, ctx := dd.startSpanFromContext(context.Background(), dd.callerOffset+5,
 		tracer.ChildOf(parentCtx),
+		tracer.StartTime(started),
 	)
 	return &DataDogTracerSpan{
 		span:    s,
@@ -321,6 +401,11 @@ func (dd *DataDogTracer) StartFollowSpan(object interface{}) common.TracerSpan {
 	}
 }
 
+// SetSampler makes root spans be kept by agent, as sampler of traces has already kept them
+func (dd *DataDogTracer) SetSampler(s *common.Sampler) {
+	dd.sampled = s != nil
+}
+
 func (dd *DataDogTracer) SetCallerOffset(offset int) {
 	dd.callerOffset = offset
 }
@@ -329,6 +414,23 @@ func (dd *DataDogTracer) Stop() {
 	tracer.Stop()
 }
 
+func (dd *DataDogTracer) Flush(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+		tracer.Flush()
+		return nil
+	})
+}
+
+// Shutdown flushes buffered spans by stopping global tracer
+func (dd *DataDogTracer) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+		tracer.Stop()
+		return nil
+	})
+}
+
 func startDataDogTracer(options DataDogTracerOptions, logger common.Logger) bool {
 
 	disabled := utils.IsEmpty(options.AgentHost)
@@ -346,6 +448,7 @@ func startDataDogTracer(options DataDogTracerOptions, logger common.Logger) bool
 	opts = append(opts, tracer.WithServiceName(options.ServiceName))
 	opts = append(opts, tracer.WithServiceVersion(options.Version))
 	opts = append(opts, tracer.WithEnv(options.Environment))
+	opts = append(opts, tracer.WithHTTPRoundTripper(&DataDogTracerTransport{next: http.DefaultTransport}))
 
 	if options.Debug {
 		opts = append(opts, tracer.WithLogger(&DataDogInternalLogger{logger: logger}))
@@ -532,6 +635,22 @@ func (dd *DataDogLogger) Stop() {
 	}
 }
 
+func (dd *DataDogLogger) Flush(ctx context.Context) error {
+
+	if dd.connection == nil {
+		return nil
+	}
+	return dd.connection.Flush(ctx)
+}
+
+func (dd *DataDogLogger) Shutdown(ctx context.Context) error {
+
+	if dd.connection == nil {
+		return nil
+	}
+	return waitContext(ctx, dd.connection.Close)
+}
+
 func NewDataDogLogger(options DataDogLoggerOptions, logger common.Logger, stdout *Stdout) *DataDogLogger {
 
 	if logger == nil {
@@ -543,40 +662,21 @@ func NewDataDogLogger(options DataDogLoggerOptions, logger common.Logger, stdout
 		return nil
 	}
 
-	address := fmt.Sprintf("%s:%d", options.AgentHost, options.AgentPort)
-	serverAddr, err := net.ResolveUDPAddr("udp", address)
-	if err != nil {
-		stdout.Error(err)
-		return nil
-	}
-
-	connection, err := net.DialUDP("udp", nil, serverAddr)
-	if err != nil {
-		stdout.Error(err)
-		return nil
-	}
+	connection := NewAgentWriter(AgentWriterOptions{
+		Network:    "udp",
+		Host:       options.AgentHost,
+		Port:       options.AgentPort,
+		BufferSize: options.BufferSize,
+		Provider:   "datadog",
+		Signal:     common.TelemetryLogs,
+	})
 
 	formatter := &logrus.JSONFormatter{}
 	formatter.TimestampFormat = time.RFC3339Nano
 
 	log := logrus.New()
 	log.SetFormatter(formatter)
-
-	switch options.Level {
-	case "info":
-		log.SetLevel(logrus.InfoLevel)
-	case "error":
-		log.SetLevel(logrus.ErrorLevel)
-	case "panic":
-		log.SetLevel(logrus.PanicLevel)
-	case "warn":
-		log.SetLevel(logrus.WarnLevel)
-	case "debug":
-		log.SetLevel(logrus.DebugLevel)
-	default:
-		log.SetLevel(logrus.InfoLevel)
-	}
-
+	log.SetLevel(logLevel(options.Level))
 	log.SetOutput(connection)
 
 	logger.Info("DataDog logger is up...")
@@ -595,12 +695,20 @@ func (ddm *DataDogMeter) getGlobalTags() []string {
 	var tags []string
 
 	for _, v := range strings.Split(ddm.options.Tags, ",") {
+		if utils.IsEmpty(v) {
+			continue
+		}
 		tags = append(tags, strings.Replace(v, "=", ":", 1))
 	}
 	return tags
 }
 
-func (ddm *DataDogMeter) getLabelTags(labelValues ...string) []string {
+func (ddm *DataDogMeter) getLabelTags(labels common.Labels) ([]string, error) {
+
+	labels, err := common.DataDogMetricNaming.Labels(labels)
+	if err != nil {
+		return nil, err
+	}
 
 	var tags []string
 
@@ -609,7 +717,45 @@ func (ddm *DataDogMeter) getLabelTags(labelValues ...string) []string {
 	tags = append(tags, fmt.Sprintf("dd.version:%s", ddm.options.Version))
 	tags = append(tags, fmt.Sprintf("dd.env:%s", ddm.options.Environment))
 
-	return tags
+	var arr []string
+	for k, v := range labels {
+		arr = append(arr, fmt.Sprintf("%s:%s", k, v))
+	}
+	sort.Strings(arr)
+
+	return append(tags, arr...), nil
+}
+
+// recorded counts metric accepted by statsd client, which sends over UDP in background
+// and has no delivery result, so DataDog metrics are not counted as sent or failed
+func (ddm *DataDogMeter) recorded(err error) {
+
+	if err != nil {
+		ddm.logger.Error(err)
+		common.GetTelemetry().Dropped("datadog", common.TelemetryMetrics, 1)
+		return
+	}
+	common.GetTelemetry().Queued("datadog", common.TelemetryMetrics, 1)
+}
+
+func (ddm *DataDogMeter) build(name string, labels common.Labels, prefixes ...string) (string, []string, error) {
+
+	var names []string
+
+	names = append(names, ddm.options.Prefix)
+	names = append(names, prefixes...)
+	names = append(names, name)
+
+	newName, err := common.DataDogMetricNaming.Name(names...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tags, err := ddm.getLabelTags(labels)
+	if err != nil {
+		return "", nil, err
+	}
+	return newName, tags, nil
 }
 
 func (ddm *DataDogMeter) SetCallerOffset(offset int) {
@@ -618,128 +764,213 @@ func (ddm *DataDogMeter) SetCallerOffset(offset int) {
 
 func (ddmc *DataDogCounter) Inc() common.Counter {
 
-	/*newValues := ddmc.meter.getLabelTags(labelValues...)
-	for k, v := range ddmc.labels {
+	return ddmc.Add(1)
+}
 
-		value := ""
-		if len(labelValues) > (k - 1) {
-			value = labelValues[k]
-			tag := fmt.Sprintf("%s:%s", v, value)
-			newValues = append(newValues, tag)
-		}
-	}
+func (ddmc *DataDogCounter) Add(value int) common.Counter {
 
-	_, file, line := utils.CallerGetInfo(ddmc.meter.callerOffset + 3)
-	newValues = append(newValues, fmt.Sprintf("file:%s", fmt.Sprintf("%s:%d", file, line)))
+	ddmc.meter.recorded(ddmc.meter.client.Count(ddmc.name, int64(value), ddmc.tags, 1))
+	return ddmc
+}
 
-	err := ddmc.meter.client.Incr(ddmc.name, newValues, 1)
-	if err != nil {
-		ddmc.meter.logger.Error(err)
-	}
-	return ddmc*/
-	return nil
+// AddWithSpan adds value only, as statsd has no exemplars
+func (ddmc *DataDogCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+
+	return ddmc.Add(value)
 }
 
 func (ddm *DataDogMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
 
-	/*var names []string
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return nil
+	}
 
-	if !utils.IsEmpty(ddm.options.Prefix) {
-		names = append(names, ddm.options.Prefix)
+	return &DataDogCounter{
+		meter:       ddm,
+		name:        newName,
+		description: description,
+		tags:        tags,
 	}
+}
 
-	if len(prefixes) > 0 {
-		names = append(names, strings.Join(prefixes, "_"))
+// Add sends whole part of value and keeps the rest, as statsd client counts only integers
+func (ddmfc *DataDogFloatCounter) Add(value float64) common.FloatCounter {
+
+	ddmfc.mutex.Lock()
+	ddmfc.remainder = ddmfc.remainder + value
+	whole := math.Floor(ddmfc.remainder)
+	ddmfc.remainder = ddmfc.remainder - whole
+	ddmfc.mutex.Unlock()
+
+	if whole == 0 {
+		return ddmfc
 	}
 
-	newName := name
-	if len(names) > 0 {
-		newName = fmt.Sprintf("%s.%s", strings.Join(names, "."), newName)
+	ddmfc.meter.recorded(ddmfc.meter.client.Count(ddmfc.name, int64(whole), ddmfc.tags, 1))
+	return ddmfc
+}
+
+func (ddm *DataDogMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return nil
 	}
 
-	return &DataDogCounter{
+	return &DataDogFloatCounter{
 		meter:       ddm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		tags:        tags,
+	}
+}
+
+func (ddmg *DataDogGauge) send(value float64) common.Gauge {
+
+	ddmg.meter.recorded(ddmg.meter.client.Gauge(ddmg.name, value, ddmg.tags, 1))
+	return ddmg
 }
 
 func (ddmg *DataDogGauge) Set(value float64) common.Gauge {
 
-	/*newValues := ddmg.meter.getLabelTags(labelValues...)
-	for k, v := range ddmg.labels {
+	return ddmg.send(ddmg.value.Set(value))
+}
 
-		value := ""
-		if len(labelValues) > (k - 1) {
-			value = labelValues[k]
-			tag := fmt.Sprintf("%s:%s", v, value)
-			newValues = append(newValues, tag)
-		}
-	}
+func (ddmg *DataDogGauge) Add(value float64) common.Gauge {
 
-	_, file, line := utils.CallerGetInfo(ddmg.meter.callerOffset + 3)
-	newValues = append(newValues, fmt.Sprintf("file:%s", fmt.Sprintf("%s:%d", file, line)))
+	return ddmg.send(ddmg.value.Add(value))
+}
 
-	err := ddmg.meter.client.Gauge(ddmg.name, value, newValues, value)
-	if err != nil {
-		ddmg.meter.logger.Error(err)
-	}
-	return ddmg*/
-	return nil
+func (ddmg *DataDogGauge) Sub(value float64) common.Gauge {
+
+	return ddmg.send(ddmg.value.Add(-value))
 }
 
-func (ddm *DataDogMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+func (ddmg *DataDogGauge) Inc() common.Gauge {
+
+	return ddmg.Add(1)
+}
+
+func (ddmg *DataDogGauge) Dec() common.Gauge {
+
+	return ddmg.Sub(1)
+}
 
-	/*var names []string
+func (ddm *DataDogMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
 
-	if !utils.IsEmpty(ddm.options.Prefix) {
-		names = append(names, ddm.options.Prefix)
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return nil
 	}
 
-	if len(prefixes) > 0 {
-		names = append(names, strings.Join(prefixes, "_"))
+	// gauge keeps its value, so the same name and tags share it
+	key := fmt.Sprintf("%s%v", newName, tags)
+	if _, ok := ddm.observables.Load(key); ok {
+		ddm.logger.Error(fmt.Errorf("datadog gauge %s is observable, it can't be set", key))
+		return nil
 	}
 
-	newName := name
-	if len(names) > 0 {
-		newName = fmt.Sprintf("%s.%s", strings.Join(names, "."), newName)
+	g, ok := ddm.gauges.Load(key)
+	if ok {
+		return g.(*DataDogGauge)
 	}
 
-	return &DataDogGauge{
+	g, _ = ddm.gauges.LoadOrStore(key, &DataDogGauge{
 		meter:       ddm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		tags:        tags,
+	})
+	return g.(*DataDogGauge)
 }
 
-func (ddm *DataDogMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+// ObservableGauge keeps callback of the first registration, series of gauge which is set can't be observed
+func (ddm *DataDogMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
 
-	/*var names []string
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return
+	}
 
-	if !utils.IsEmpty(ddm.options.Prefix) {
-		names = append(names, ddm.options.Prefix)
+	key := fmt.Sprintf("%s%v", newName, tags)
+	if _, ok := ddm.gauges.Load(key); ok {
+		ddm.logger.Error(fmt.Errorf("datadog gauge %s is set, it can't be observable", key))
+		return
+	}
+	if _, loaded := ddm.observables.LoadOrStore(key, true); loaded {
+		return
 	}
 
-	if len(prefixes) > 0 {
-		names = append(names, strings.Join(prefixes, "_"))
+	gauge := &DataDogGauge{
+		meter:       ddm,
+		name:        newName,
+		description: description,
+		tags:        tags,
 	}
+	ddm.observer.Observe(func() {
+		gauge.Set(callback())
+	})
+}
+
+func (ddmh *DataDogHistogram) Observe(value float64) common.Histogram {
+
+	ddmh.meter.recorded(ddmh.meter.client.Histogram(ddmh.name, value, ddmh.tags, 1))
+	return ddmh
+}
+
+// ObserveWithSpan observes value only, as statsd has no exemplars
+func (ddmh *DataDogHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+
+	return ddmh.Observe(value)
+}
+
+func (ddm *DataDogMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
 
-	newName := name
-	if len(names) > 0 {
-		newName = fmt.Sprintf("%s.%s", strings.Join(names, "."), newName)
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return nil
 	}
 
 	return &DataDogHistogram{
 		meter:       ddm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		tags:        tags,
+	}
+}
+
+func (ddm *DataDogMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	return ddm.Histogram(group, name, description, labels, prefixes...)
+}
+
+func (ddms *DataDogSummary) Observe(value float64) common.Summary {
+
+	ddms.meter.recorded(ddms.meter.client.Distribution(ddms.name, value, ddms.tags, 1))
+	return ddms
+}
+
+// Summary is sent as distribution, quantiles and window are ignored, percentiles are configured on DataDog side
+func (ddm *DataDogMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	newName, tags, err := ddm.build(name, labels, prefixes...)
+	if err != nil {
+		ddm.logger.Error(err)
+		return nil
+	}
+
+	return &DataDogSummary{
+		meter:       ddm,
+		name:        newName,
+		description: description,
+		tags:        tags,
+	}
 }
 
 func (ddm *DataDogMeter) Group(name string) common.Group {
@@ -748,7 +979,23 @@ func (ddm *DataDogMeter) Group(name string) common.Group {
 }
 
 func (ddm *DataDogMeter) Stop() {
-	// nothing here
+
+	err := ddm.Shutdown(context.Background())
+	if err != nil {
+		ddm.logger.Error(err)
+	}
+}
+
+func (ddm *DataDogMeter) Flush(ctx context.Context) error {
+	return waitContext(ctx, ddm.client.Flush)
+}
+
+func (ddm *DataDogMeter) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+		ddm.observer.Stop()
+		return ddm.client.Close()
+	})
 }
 
 func NewDataDogMeter(options DataDogMeterOptions, logger common.Logger, stdout *Stdout) *DataDogMeter {
@@ -775,6 +1022,9 @@ func NewDataDogMeter(options DataDogMeterOptions, logger common.Logger, stdout *
 		logger:       logger,
 		callerOffset: 1,
 		client:       client,
+		gauges:       &sync.Map{},
+		observables:  &sync.Map{},
+		observer:     NewMeterObserver(MeterObserverDefaultInterval),
 	}
 }
 
@@ -832,13 +1082,18 @@ func (dde *DataDogEventer) Interval(name string, message string, attributes map[
 
 	body.SetTags(tags)
 
+	started := time.Now()
 	resp, r, err := dde.client.EventsApi.CreateEvent(dde.ctx, body)
 
+	t := common.GetTelemetry()
+	t.Export("datadog", common.TelemetryEvents, started, err)
 	if err != nil {
+		t.Failed("datadog", common.TelemetryEvents, 1)
 		dde.logger.Error(err)
 		dde.logger.Error("Full HTTP response:", r)
 		return err
 	}
+	t.Sent("datadog", common.TelemetryEvents, 1)
 	dde.logger.Debug(fmt.Sprintf("%v", resp))
 	return nil
 }
@@ -855,6 +1110,16 @@ func (dde *DataDogEventer) Stop() {
 	dde.logger.Info("DataDog eventer is stopped.")
 }
 
+// Flush does nothing, events are sent at once
+func (dde *DataDogEventer) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (dde *DataDogEventer) Shutdown(ctx context.Context) error {
+	dde.Stop()
+	return nil
+}
+
 func NewDataDogEventer(options DataDogEventerOptions, logger common.Logger, stdout *Stdout) *DataDogEventer {
 
 	if logger == nil {
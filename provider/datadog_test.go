@@ -3,12 +3,16 @@ package provider
 import (
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/devopsext/sre/common"
 	"github.com/devopsext/utils"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 func datadogNewTracer(agentHost string) (*DataDogTracer, *Stdout) {
@@ -180,6 +184,47 @@ func TestDataDogTracer(t *testing.T) {
 	datadog.Stop()
 }
 
+func TestDataDogTracerSampler(t *testing.T) {
+
+	datadog, _ := datadogNewTracer("localhost")
+	if datadog == nil {
+		t.Fatal("Invalid datadog")
+	}
+	defer datadog.Stop()
+
+	priority := func() string {
+		span := datadog.StartSpanWithTraceID("0af7651916cd43dd8448eb211c80319c", "")
+		if span == nil {
+			t.Fatal("Invalid trace span")
+		}
+		defer span.Finish()
+
+		carrier := tracer.TextMapCarrier{}
+		if err := tracer.Inject(span.(*DataDogTracerSpan).span.Context(), carrier); err != nil {
+			t.Fatal(err)
+		}
+		return carrier[tracer.DefaultPriorityHeader]
+	}
+
+	// agent samples traces itself, if traces have no sampler
+	keep := strconv.Itoa(ext.PriorityUserKeep)
+	if p := priority(); p == keep {
+		t.Fatalf("Wrong priority without sampler: %s", p)
+	}
+
+	sampler, err := common.NewSampler(common.SamplerOptions{Type: common.SamplerTypeAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	traces := common.NewTraces()
+	traces.Register(datadog)
+	traces.SetSampler(sampler)
+
+	if p := priority(); p != keep {
+		t.Fatalf("Wrong priority with sampler: %s", p)
+	}
+}
+
 func TestDataDogTracerWrongAgentHost(t *testing.T) {
 
 	datadog, _ := datadogNewTracer("")
@@ -256,6 +301,35 @@ func TestDataDogTracerWrongSpanContext(t *testing.T) {
 
 }
 
+func TestDataDogTracerTransport(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	client := &http.Client{Transport: &DataDogTracerTransport{next: http.DefaultTransport}}
+	for _, count := range []string{"", "2"} {
+
+		req, _ := http.NewRequest("POST", server.URL, nil)
+		req.Header.Set(dataDogTraceCountHeader, count)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	labels := common.Labels{"provider": "datadog", "signal": common.TelemetryTraces}
+	if v := meter.CounterValue("telemetry_records_sent", labels); v != 2 {
+		t.Fatalf("Invalid sent traces %v, expected 2", v)
+	}
+}
+
 func TestDataDogMeter(t *testing.T) {
 
 	datadog, _ := datadogNewMeter("localhost")
@@ -282,6 +356,23 @@ func TestDataDogMeter(t *testing.T) {
 		counter.Inc()
 	}
 
+	summary := datadog.Summary("", metricName, "description", labels, []float64{0.5, 0.99}, time.Minute, "summary")
+	if summary == nil {
+		t.Fatal("Invalid datadog summary")
+	}
+	summary.Observe(1).Observe(2)
+
+	// observable gauge can't be set, gauge which is set can't get callback
+	datadog.ObservableGauge("", "observed", "description", nil, func() float64 { return 42 })
+	if datadog.Gauge("", "observed", "description", nil) != nil {
+		t.Fatal("Observable gauge is returned as gauge")
+	}
+	datadog.Gauge("", "inflight", "description", nil).Set(1)
+	datadog.ObservableGauge("", "inflight", "description", nil, func() float64 { return 42 })
+	if datadog.Gauge("", "inflight", "description", nil) == nil {
+		t.Fatal("Gauge is observable")
+	}
+
 	datadog.Stop()
 }
 
@@ -394,8 +485,11 @@ func TestDataDogLoggerEmptyAgentHost(t *testing.T) {
 
 func TestDataDogLoggerWrongAgentHost(t *testing.T) {
 
+	// agent might be unavailable on startup, logger connects later
 	datadog, _ := datadogNewLogger("ewqdWDEW1111ss", "how")
-	if datadog != nil {
-		t.Fatal("Valid datadog")
+	if datadog == nil {
+		t.Fatal("Invalid datadog")
 	}
+	defer datadog.Stop()
+	datadog.Info("info")
 }
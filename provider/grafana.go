@@ -119,11 +119,17 @@ func (ge *GrafanaEventer) Interval(name string, message string, attributes map[s
 		Text:    name,
 	}
 
+	started := time.Now()
 	ar, err := ge.createAnnotation(a)
+
+	t := common.GetTelemetry()
+	t.Export("grafana", common.TelemetryEvents, started, err)
 	if err != nil {
+		t.Failed("grafana", common.TelemetryEvents, 1)
 		ge.logger.Error(err)
 		return err
 	}
+	t.Sent("grafana", common.TelemetryEvents, 1)
 	ge.logger.Debug("Annotation %d. %s", ar.ID, ar.Message)
 	return nil
 }
@@ -140,6 +146,14 @@ func (ge *GrafanaEventer) Stop() {
 	// nothing here
 }
 
+func (ge *GrafanaEventer) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (ge *GrafanaEventer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
 func NewGrafanaEventer(options GrafanaEventerOptions, logger common.Logger, stdout *Stdout) *GrafanaEventer {
 
 	if logger == nil {
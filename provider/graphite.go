@@ -0,0 +1,617 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	GraphiteProtocolPlaintext = "plaintext"
+	GraphiteProtocolPickle    = "pickle"
+)
+
+const (
+	GraphiteDefaultFlushInterval = time.Second * 10
+	graphiteTimeout              = time.Second * 5
+	graphitePickleBatchSize      = 500
+)
+
+var GraphiteDefaultPercentiles = []float64{0.5, 0.9, 0.99}
+
+type GraphiteOptions struct {
+	Host          string
+	Port          int
+	Prefix        string
+	Protocol      string
+	FlushInterval time.Duration
+	Percentiles   []float64
+}
+
+type graphitePoint struct {
+	path  string
+	value float64
+}
+
+// graphiteMetric is a metric which is flushed as one or more points
+type graphiteMetric interface {
+	points() []graphitePoint
+}
+
+type GraphiteCounter struct {
+	meter       *GraphiteMeter
+	path        string
+	description string
+	mutex       sync.Mutex
+	value       float64
+}
+
+type GraphiteGauge struct {
+	meter       *GraphiteMeter
+	path        string
+	description string
+	value       MeterGaugeValue
+}
+
+type graphiteObservableGauge struct {
+	path     string
+	callback func() float64
+}
+
+// GraphiteHistogram keeps values observed during flush interval to calculate percentiles
+type GraphiteHistogram struct {
+	meter       *GraphiteMeter
+	path        string
+	description string
+	mutex       sync.Mutex
+	values      []float64
+}
+
+type GraphiteMeter struct {
+	options GraphiteOptions
+	logger  common.Logger
+	address string
+	conn    net.Conn
+	mutex   sync.Mutex
+	series  *sync.Map
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func graphiteFormat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// build joins prefix, prefixes, name and label values sorted by label names into path
+func (gm *GraphiteMeter) build(name string, labels common.Labels, prefixes ...string) (string, error) {
+
+	var names []string
+
+	names = append(names, gm.options.Prefix)
+	names = append(names, prefixes...)
+	names = append(names, name)
+
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		names = append(names, labels[k])
+	}
+	return common.GraphiteMetricNaming.Name(names...)
+}
+
+// register returns already registered metric of the same path
+func (gm *GraphiteMeter) register(path string, metric graphiteMetric) graphiteMetric {
+
+	r, _ := gm.series.LoadOrStore(path, metric)
+	if fmt.Sprintf("%T", r) != fmt.Sprintf("%T", metric) {
+		gm.logger.Error("Graphite %s is already registered as %T", path, r)
+		return nil
+	}
+	return r.(graphiteMetric)
+}
+
+func (gmc *GraphiteCounter) points() []graphitePoint {
+
+	gmc.mutex.Lock()
+	defer gmc.mutex.Unlock()
+
+	return []graphitePoint{{path: gmc.path, value: gmc.value}}
+}
+
+func (gmc *GraphiteCounter) add(value float64) {
+
+	gmc.mutex.Lock()
+	gmc.value = gmc.value + value
+	gmc.mutex.Unlock()
+}
+
+func (gmc *GraphiteCounter) Inc() common.Counter {
+
+	return gmc.Add(1)
+}
+
+func (gmc *GraphiteCounter) Add(value int) common.Counter {
+
+	gmc.add(float64(value))
+	return gmc
+}
+
+// AddWithSpan adds value only, as graphite has no exemplars
+func (gmc *GraphiteCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+
+	return gmc.Add(value)
+}
+
+// GraphiteFloatCounter shares counter path, so integer and float parts are summed
+type GraphiteFloatCounter struct {
+	*GraphiteCounter
+}
+
+func (gmfc *GraphiteFloatCounter) Add(value float64) common.FloatCounter {
+
+	gmfc.add(value)
+	return gmfc
+}
+
+func (gm *GraphiteMeter) counter(name, description string, labels common.Labels, prefixes ...string) *GraphiteCounter {
+
+	path, err := gm.build(name, labels, prefixes...)
+	if err != nil {
+		gm.logger.Error(err)
+		return nil
+	}
+
+	r := gm.register(path, &GraphiteCounter{meter: gm, path: path, description: description})
+	if r == nil {
+		return nil
+	}
+	return r.(*GraphiteCounter)
+}
+
+// Counter is flushed as total since start
+func (gm *GraphiteMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
+
+	c := gm.counter(name, description, labels, prefixes...)
+	if c == nil {
+		return nil
+	}
+	return c
+}
+
+func (gm *GraphiteMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	c := gm.counter(name, description, labels, prefixes...)
+	if c == nil {
+		return nil
+	}
+	return &GraphiteFloatCounter{GraphiteCounter: c}
+}
+
+func (gmg *GraphiteGauge) points() []graphitePoint {
+
+	return []graphitePoint{{path: gmg.path, value: gmg.value.Add(0)}}
+}
+
+func (gmg *GraphiteGauge) Set(value float64) common.Gauge {
+
+	gmg.value.Set(value)
+	return gmg
+}
+
+func (gmg *GraphiteGauge) Add(value float64) common.Gauge {
+
+	gmg.value.Add(value)
+	return gmg
+}
+
+func (gmg *GraphiteGauge) Sub(value float64) common.Gauge {
+
+	gmg.value.Add(-value)
+	return gmg
+}
+
+func (gmg *GraphiteGauge) Inc() common.Gauge {
+
+	return gmg.Add(1)
+}
+
+func (gmg *GraphiteGauge) Dec() common.Gauge {
+
+	return gmg.Sub(1)
+}
+
+func (gm *GraphiteMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+
+	path, err := gm.build(name, labels, prefixes...)
+	if err != nil {
+		gm.logger.Error(err)
+		return nil
+	}
+
+	r := gm.register(path, &GraphiteGauge{meter: gm, path: path, description: description})
+	if r == nil {
+		return nil
+	}
+	return r.(*GraphiteGauge)
+}
+
+func (gmog *graphiteObservableGauge) points() []graphitePoint {
+
+	value := gmog.callback()
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return []graphitePoint{{path: gmog.path, value: value}}
+}
+
+// ObservableGauge calls callback on every flush
+func (gm *GraphiteMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	path, err := gm.build(name, labels, prefixes...)
+	if err != nil {
+		gm.logger.Error(err)
+		return
+	}
+	gm.register(path, &graphiteObservableGauge{path: path, callback: callback})
+}
+
+func graphitePercentile(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p*100, 'f', -1, 64), ".", "_")
+}
+
+// points returns count, sum, min, max and percentiles of the interval and resets values
+func (gmh *GraphiteHistogram) points() []graphitePoint {
+
+	gmh.mutex.Lock()
+	values := gmh.values
+	gmh.values = nil
+	gmh.mutex.Unlock()
+
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Float64s(values)
+
+	sum := 0.0
+	for _, v := range values {
+		sum = sum + v
+	}
+
+	points := []graphitePoint{
+		{path: gmh.path + ".count", value: float64(len(values))},
+		{path: gmh.path + ".sum", value: sum},
+		{path: gmh.path + ".min", value: values[0]},
+		{path: gmh.path + ".max", value: values[len(values)-1]},
+	}
+
+	for _, p := range gmh.meter.options.Percentiles {
+		n := int(math.Ceil(p*float64(len(values)))) - 1
+		if n < 0 {
+			n = 0
+		}
+		points = append(points, graphitePoint{path: fmt.Sprintf("%s.%s", gmh.path, graphitePercentile(p)), value: values[n]})
+	}
+	return points
+}
+
+func (gmh *GraphiteHistogram) Observe(value float64) common.Histogram {
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		common.GetTelemetry().Rejected("graphite", common.TelemetryMetrics, 1)
+		return gmh
+	}
+
+	gmh.mutex.Lock()
+	gmh.values = append(gmh.values, value)
+	gmh.mutex.Unlock()
+	return gmh
+}
+
+// ObserveWithSpan observes value only, as graphite has no exemplars
+func (gmh *GraphiteHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+
+	return gmh.Observe(value)
+}
+
+func (gm *GraphiteMeter) histogram(name, description string, labels common.Labels, prefixes ...string) *GraphiteHistogram {
+
+	path, err := gm.build(name, labels, prefixes...)
+	if err != nil {
+		gm.logger.Error(err)
+		return nil
+	}
+
+	r := gm.register(path, &GraphiteHistogram{meter: gm, path: path, description: description})
+	if r == nil {
+		return nil
+	}
+	return r.(*GraphiteHistogram)
+}
+
+func (gm *GraphiteMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+
+	h := gm.histogram(name, description, labels, prefixes...)
+	if h == nil {
+		return nil
+	}
+	return h
+}
+
+func (gm *GraphiteMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	return gm.Histogram(group, name, description, labels, prefixes...)
+}
+
+// GraphiteSummary is flushed as histogram with meter percentiles
+type GraphiteSummary struct {
+	*GraphiteHistogram
+}
+
+func (gms *GraphiteSummary) Observe(value float64) common.Summary {
+
+	gms.GraphiteHistogram.Observe(value)
+	return gms
+}
+
+func (gm *GraphiteMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	h := gm.histogram(name, description, labels, prefixes...)
+	if h == nil {
+		return nil
+	}
+	return &GraphiteSummary{GraphiteHistogram: h}
+}
+
+func (gm *GraphiteMeter) Group(name string) common.Group {
+
+	return nil
+}
+
+func (gm *GraphiteMeter) points() []graphitePoint {
+
+	var points []graphitePoint
+	gm.series.Range(func(key, value interface{}) bool {
+		points = append(points, value.(graphiteMetric).points()...)
+		return true
+	})
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].path < points[j].path
+	})
+	return points
+}
+
+func graphitePlaintext(points []graphitePoint, timestamp int64) [][]byte {
+
+	var bb bytes.Buffer
+	for _, p := range points {
+		bb.WriteString(fmt.Sprintf("%s %s %d\n", p.path, graphiteFormat(p.value), timestamp))
+	}
+	return [][]byte{bb.Bytes()}
+}
+
+// graphitePickle encodes list of (path, (timestamp, value)) tuples by pickle protocol 2,
+// each batch is preceded by its length
+func graphitePickle(points []graphitePoint, timestamp int64) [][]byte {
+
+	var payloads [][]byte
+	for i := 0; i < len(points); i = i + graphitePickleBatchSize {
+
+		end := i + graphitePickleBatchSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		var bb bytes.Buffer
+		bb.Write([]byte{0x80, 0x02, ']', '('})
+		for _, p := range points[i:end] {
+			bb.WriteByte('X')
+			binary.Write(&bb, binary.LittleEndian, uint32(len(p.path)))
+			bb.WriteString(p.path)
+			bb.WriteByte('J')
+			binary.Write(&bb, binary.LittleEndian, int32(timestamp))
+			bb.WriteByte('G')
+			binary.Write(&bb, binary.BigEndian, math.Float64bits(p.value))
+			bb.Write([]byte{0x86, 0x86})
+		}
+		bb.Write([]byte{'e', '.'})
+
+		payload := make([]byte, 4, 4+bb.Len())
+		binary.BigEndian.PutUint32(payload, uint32(bb.Len()))
+		payloads = append(payloads, append(payload, bb.Bytes()...))
+	}
+	return payloads
+}
+
+func (gm *GraphiteMeter) connect() error {
+
+	if gm.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", gm.address, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	gm.conn = conn
+	return nil
+}
+
+func (gm *GraphiteMeter) send(payloads [][]byte) error {
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	// connection might be closed by server, so reconnect once
+	var err error
+	for i := 0; i < 2; i++ {
+
+		if err = gm.connect(); err != nil {
+			return err
+		}
+
+		gm.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+		for _, payload := range payloads {
+			if _, err = gm.conn.Write(payload); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return nil
+		}
+
+		gm.conn.Close()
+		gm.conn = nil
+	}
+	return err
+}
+
+func (gm *GraphiteMeter) export() error {
+
+	points := gm.points()
+	if len(points) == 0 {
+		return nil
+	}
+
+	timestamp := time.Now().Unix()
+
+	var payloads [][]byte
+	if gm.options.Protocol == GraphiteProtocolPickle {
+		payloads = graphitePickle(points, timestamp)
+	} else {
+		payloads = graphitePlaintext(points, timestamp)
+	}
+
+	started := time.Now()
+	err := gm.send(payloads)
+	common.GetTelemetry().Export("graphite", common.TelemetryMetrics, started, err)
+	if err != nil {
+		common.GetTelemetry().Failed("graphite", common.TelemetryMetrics, len(points))
+		return err
+	}
+	common.GetTelemetry().Sent("graphite", common.TelemetryMetrics, len(points))
+	return nil
+}
+
+// Flush sends what is collected since the previous flush
+func (gm *GraphiteMeter) Flush(ctx context.Context) error {
+	return waitContext(ctx, gm.export)
+}
+
+func (gm *GraphiteMeter) flush() {
+
+	defer gm.wg.Done()
+
+	ticker := time.NewTicker(gm.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gm.stop:
+			return
+		case <-ticker.C:
+			if err := gm.export(); err != nil {
+				gm.logger.Error(err)
+			}
+		}
+	}
+}
+
+func (gm *GraphiteMeter) Stop() {
+
+	err := gm.Shutdown(context.Background())
+	if err != nil {
+		gm.logger.Error(err)
+	}
+}
+
+// Shutdown stops flushing by interval and sends the rest of points
+func (gm *GraphiteMeter) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+
+		var err error
+		gm.once.Do(func() {
+			close(gm.stop)
+			gm.wg.Wait()
+			err = gm.export()
+
+			gm.mutex.Lock()
+			defer gm.mutex.Unlock()
+
+			if gm.conn != nil {
+				err = errors.Join(err, gm.conn.Close())
+				gm.conn = nil
+			}
+		})
+		return err
+	})
+}
+
+func NewGraphiteMeter(options GraphiteOptions, logger common.Logger, stdout *Stdout) *GraphiteMeter {
+
+	if logger == nil {
+		logger = stdout
+	}
+
+	if utils.IsEmpty(options.Host) {
+		stdout.Debug("Graphite meter is disabled.")
+		return nil
+	}
+
+	if utils.IsEmpty(options.Protocol) {
+		options.Protocol = GraphiteProtocolPlaintext
+	}
+	if options.Protocol != GraphiteProtocolPlaintext && options.Protocol != GraphiteProtocolPickle {
+		logger.Error("Graphite protocol %s is not supported", options.Protocol)
+		return nil
+	}
+
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = GraphiteDefaultFlushInterval
+	}
+	if options.Percentiles == nil {
+		options.Percentiles = GraphiteDefaultPercentiles
+	}
+	for _, p := range options.Percentiles {
+		if p <= 0 || p > 1 {
+			logger.Error("Graphite percentile %v should be in (0, 1]", p)
+			return nil
+		}
+	}
+
+	gm := &GraphiteMeter{
+		options: options,
+		logger:  logger,
+		address: net.JoinHostPort(options.Host, strconv.Itoa(options.Port)),
+		series:  &sync.Map{},
+		stop:    make(chan struct{}),
+	}
+
+	// graphite might be unavailable on startup, meter connects on flush
+	if err := gm.connect(); err != nil {
+		logger.Warn(err)
+	}
+
+	gm.wg.Add(1)
+	go gm.flush()
+
+	logger.Info("Graphite meter is up...")
+	return gm
+}
@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsext/sre/common"
+)
+
+var graphiteTestTimestamp = regexp.MustCompile(` \d+$`)
+
+type graphiteTestServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     []byte
+	wg       sync.WaitGroup
+}
+
+func (s *graphiteTestServer) serve() {
+
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			data, _ := io.ReadAll(conn)
+			s.mutex.Lock()
+			s.data = append(s.data, data...)
+			s.mutex.Unlock()
+		}()
+	}
+}
+
+func (s *graphiteTestServer) close() []byte {
+
+	s.listener.Close()
+	s.wg.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data
+}
+
+func graphiteNewServer(t *testing.T, address string) *graphiteTestServer {
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &graphiteTestServer{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func graphiteNewMeter(t *testing.T, address string, protocol string) *GraphiteMeter {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := net.LookupPort("tcp", port)
+
+	graphite := NewGraphiteMeter(GraphiteOptions{
+		Host:          host,
+		Port:          p,
+		Prefix:        "test",
+		Protocol:      protocol,
+		FlushInterval: time.Hour,
+		Percentiles:   []float64{0.5, 0.999},
+	}, nil, stdout)
+	if graphite == nil {
+		t.Fatal("Invalid graphite")
+	}
+	return graphite
+}
+
+func TestGraphiteMeterPlaintext(t *testing.T) {
+
+	server := graphiteNewServer(t, "127.0.0.1:0")
+	graphite := graphiteNewMeter(t, server.listener.Addr().String(), GraphiteProtocolPlaintext)
+
+	labels := common.Labels{"method": "GET", "code": "200"}
+	graphite.Counter("", "requests", "Requests", labels, "http").Add(2).Inc()
+	graphite.FloatCounter("", "requests", "Requests", labels, "http").Add(0.5)
+	graphite.Gauge("", "load", "Load", nil).Set(3).Dec()
+	graphite.ObservableGauge("", "uptime", "Uptime", nil, func() float64 { return 7 })
+
+	histogram := graphite.Histogram("", "latency", "Latency", common.Labels{"path": "/api/v1"}, "http")
+	for i := 1; i <= 4; i++ {
+		histogram.Observe(float64(i))
+	}
+	graphite.Summary("", "empty", "Empty", nil, nil, time.Minute)
+
+	if graphite.Gauge("", "requests", "Requests", labels, "http") != nil {
+		t.Fatal("Gauge is registered over counter")
+	}
+
+	graphite.Stop()
+	data := server.close()
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		lines = append(lines, graphiteTestTimestamp.ReplaceAllString(scanner.Text(), ""))
+	}
+
+	expected := []string{
+		"test.http.latency._api_v1.count 4",
+		"test.http.latency._api_v1.max 4",
+		"test.http.latency._api_v1.min 1",
+		"test.http.latency._api_v1.p50 2",
+		"test.http.latency._api_v1.p99_9 4",
+		"test.http.latency._api_v1.sum 10",
+		"test.http.requests.200.GET 3.5",
+		"test.load 2",
+		"test.uptime 7",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Wrong lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestGraphiteMeterPickle(t *testing.T) {
+
+	server := graphiteNewServer(t, "127.0.0.1:0")
+	graphite := graphiteNewMeter(t, server.listener.Addr().String(), GraphiteProtocolPickle)
+
+	graphite.Gauge("", "load", "Load", nil).Set(1.5)
+	graphite.Stop()
+	data := server.close()
+
+	if len(data) < 4 {
+		t.Fatalf("Wrong pickle payload: %v", data)
+	}
+	size := binary.BigEndian.Uint32(data[:4])
+	payload := data[4:]
+	if int(size) != len(payload) {
+		t.Fatalf("Wrong pickle size: %d != %d", size, len(payload))
+	}
+	if !strings.HasPrefix(string(payload), "\x80\x02](X\x09\x00\x00\x00test.loadJ") || !strings.HasSuffix(string(payload), "\x86\x86e.") {
+		t.Fatalf("Wrong pickle payload: %q", payload)
+	}
+}
+
+func TestGraphiteMeterReconnect(t *testing.T) {
+
+	// take free port and release it, so graphite is unavailable on startup
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	graphite := graphiteNewMeter(t, address, GraphiteProtocolPlaintext)
+	graphite.Counter("", "events", "Events", nil).Inc()
+	if err := graphite.Flush(context.Background()); err == nil {
+		t.Fatal("Flush to unavailable graphite is succeeded")
+	}
+
+	server := graphiteNewServer(t, address)
+	graphite.Stop()
+	data := server.close()
+
+	if graphiteTestTimestamp.ReplaceAllString(strings.TrimSpace(string(data)), "") != "test.events 1" {
+		t.Fatalf("Wrong data after reconnect: %q", data)
+	}
+}
+
+func TestGraphiteMeterWrongOptions(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	if NewGraphiteMeter(GraphiteOptions{}, nil, stdout) != nil {
+		t.Fatal("Valid graphite")
+	}
+	if NewGraphiteMeter(GraphiteOptions{Host: "127.0.0.1", Port: 2003, Protocol: "udp"}, nil, stdout) != nil {
+		t.Fatal("Valid graphite with unknown protocol")
+	}
+	if NewGraphiteMeter(GraphiteOptions{Host: "127.0.0.1", Port: 2003, Percentiles: []float64{99}}, nil, stdout) != nil {
+		t.Fatal("Valid graphite with wrong percentile")
+	}
+}
@@ -0,0 +1,637 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	InfluxDBDefaultFlushInterval = time.Second * 10
+	influxDBTimeout              = time.Second * 10
+	influxDBPacketSize           = 1400
+)
+
+type InfluxDBOptions struct {
+	URL           string
+	Org           string
+	Bucket        string
+	Token         string
+	Prefix        string
+	Tags          string
+	FlushInterval time.Duration
+}
+
+// influxDBField is a metric which contributes fields to the line of its measurement
+type influxDBField interface {
+	key() string
+	fields() []string
+}
+
+type influxDBMetric struct {
+	meter       *InfluxDBMeter
+	measurement string
+	field       string
+	description string
+}
+
+type InfluxDBCounter struct {
+	influxDBMetric
+	mutex sync.Mutex
+	value int64
+}
+
+type InfluxDBFloatCounter struct {
+	influxDBMetric
+	mutex sync.Mutex
+	value float64
+}
+
+type InfluxDBGauge struct {
+	influxDBMetric
+	value MeterGaugeValue
+}
+
+type influxDBObservableGauge struct {
+	influxDBMetric
+	callback func() float64
+}
+
+// influxDBAggregate keeps count, sum, min and max of values observed during flush interval
+type influxDBAggregate struct {
+	influxDBMetric
+	mutex sync.Mutex
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+type InfluxDBHistogram struct {
+	influxDBAggregate
+}
+
+type InfluxDBSummary struct {
+	influxDBAggregate
+}
+
+type InfluxDBMeter struct {
+	options InfluxDBOptions
+	logger  common.Logger
+	write   func(lines []string) error
+	client  *http.Client
+	conn    net.Conn
+	series  *sync.Map
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func influxDBFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (m *influxDBMetric) key() string {
+	return m.measurement
+}
+
+func (im *InfluxDBMeter) getTags(labels common.Labels) (string, error) {
+
+	labels, err := common.InfluxDBMetricNaming.Labels(labels)
+	if err != nil {
+		return "", err
+	}
+
+	tags := make(map[string]string)
+	for _, v := range strings.Split(im.options.Tags, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || utils.IsEmpty(kv[0]) {
+			continue
+		}
+		k, err := common.InfluxDBMetricNaming.Label(kv[0])
+		if err != nil {
+			return "", err
+		}
+		tags[k] = common.InfluxDBMetricNaming.Value(strings.TrimSpace(kv[1]))
+	}
+	for k, v := range labels {
+		// empty tag values are not allowed by line protocol
+		if utils.IsEmpty(v) {
+			continue
+		}
+		tags[k] = v
+	}
+
+	var arr []string
+	for k, v := range tags {
+		arr = append(arr, fmt.Sprintf(",%s=%s", k, v))
+	}
+	sort.Strings(arr)
+	return strings.Join(arr, ""), nil
+}
+
+// build maps prefixes to measurement and name to field, name becomes measurement without prefixes
+func (im *InfluxDBMeter) build(name, description string, labels common.Labels, prefixes ...string) (*influxDBMetric, error) {
+
+	var names []string
+
+	names = append(names, im.options.Prefix)
+	names = append(names, prefixes...)
+
+	field, err := common.InfluxDBMetricNaming.Name(name)
+	if err != nil {
+		return nil, err
+	}
+
+	measurement, err := common.InfluxDBMetricNaming.Name(names...)
+	if err != nil {
+		measurement = field
+		field = "value"
+	}
+
+	tags, err := im.getTags(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &influxDBMetric{
+		meter:       im,
+		measurement: measurement + tags,
+		field:       field,
+		description: description,
+	}, nil
+}
+
+// register returns already registered metric of the same measurement and field
+func (im *InfluxDBMeter) register(kind string, m *influxDBMetric, metric influxDBField) influxDBField {
+
+	r, _ := im.series.LoadOrStore(fmt.Sprintf("%s %s", m.measurement, m.field), metric)
+
+	if fmt.Sprintf("%T", r) != fmt.Sprintf("%T", metric) {
+		im.logger.Error("InfluxDB %s %s of %s is already registered as %T", kind, m.field, m.measurement, r)
+		return nil
+	}
+	return r.(influxDBField)
+}
+
+func (imc *InfluxDBCounter) fields() []string {
+
+	imc.mutex.Lock()
+	defer imc.mutex.Unlock()
+
+	return []string{fmt.Sprintf("%s=%di", imc.field, imc.value)}
+}
+
+func (imc *InfluxDBCounter) Inc() common.Counter {
+
+	return imc.Add(1)
+}
+
+func (imc *InfluxDBCounter) Add(value int) common.Counter {
+
+	imc.mutex.Lock()
+	imc.value = imc.value + int64(value)
+	imc.mutex.Unlock()
+	return imc
+}
+
+// AddWithSpan adds value only, as line protocol has no exemplars
+func (imc *InfluxDBCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+
+	return imc.Add(value)
+}
+
+func (im *InfluxDBMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return nil
+	}
+
+	r := im.register("counter", m, &InfluxDBCounter{influxDBMetric: *m})
+	if r == nil {
+		return nil
+	}
+	return r.(*InfluxDBCounter)
+}
+
+func (imfc *InfluxDBFloatCounter) fields() []string {
+
+	imfc.mutex.Lock()
+	defer imfc.mutex.Unlock()
+
+	return []string{fmt.Sprintf("%s=%s", imfc.field, influxDBFloat(imfc.value))}
+}
+
+func (imfc *InfluxDBFloatCounter) Add(value float64) common.FloatCounter {
+
+	imfc.mutex.Lock()
+	imfc.value = imfc.value + value
+	imfc.mutex.Unlock()
+	return imfc
+}
+
+func (im *InfluxDBMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return nil
+	}
+
+	r := im.register("float counter", m, &InfluxDBFloatCounter{influxDBMetric: *m})
+	if r == nil {
+		return nil
+	}
+	return r.(*InfluxDBFloatCounter)
+}
+
+func (img *InfluxDBGauge) fields() []string {
+
+	return []string{fmt.Sprintf("%s=%s", img.field, influxDBFloat(img.value.Add(0)))}
+}
+
+func (img *InfluxDBGauge) Set(value float64) common.Gauge {
+
+	img.value.Set(value)
+	return img
+}
+
+func (img *InfluxDBGauge) Add(value float64) common.Gauge {
+
+	img.value.Add(value)
+	return img
+}
+
+func (img *InfluxDBGauge) Sub(value float64) common.Gauge {
+
+	img.value.Add(-value)
+	return img
+}
+
+func (img *InfluxDBGauge) Inc() common.Gauge {
+
+	return img.Add(1)
+}
+
+func (img *InfluxDBGauge) Dec() common.Gauge {
+
+	return img.Sub(1)
+}
+
+func (im *InfluxDBMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return nil
+	}
+
+	r := im.register("gauge", m, &InfluxDBGauge{influxDBMetric: *m})
+	if r == nil {
+		return nil
+	}
+	return r.(*InfluxDBGauge)
+}
+
+func (imog *influxDBObservableGauge) fields() []string {
+
+	value := imog.callback()
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s=%s", imog.field, influxDBFloat(value))}
+}
+
+// ObservableGauge calls callback on every flush
+func (im *InfluxDBMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return
+	}
+	im.register("gauge", m, &influxDBObservableGauge{influxDBMetric: *m, callback: callback})
+}
+
+func (ima *influxDBAggregate) observe(value float64) {
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		common.GetTelemetry().Rejected("influxdb", common.TelemetryMetrics, 1)
+		return
+	}
+
+	ima.mutex.Lock()
+	defer ima.mutex.Unlock()
+
+	if ima.count == 0 || value < ima.min {
+		ima.min = value
+	}
+	if ima.count == 0 || value > ima.max {
+		ima.max = value
+	}
+	ima.count++
+	ima.sum = ima.sum + value
+}
+
+// fields returns aggregates of the interval and resets them
+func (ima *influxDBAggregate) fields() []string {
+
+	ima.mutex.Lock()
+	defer ima.mutex.Unlock()
+
+	if ima.count == 0 {
+		return nil
+	}
+
+	r := []string{
+		fmt.Sprintf("%s_count=%di", ima.field, ima.count),
+		fmt.Sprintf("%s_sum=%s", ima.field, influxDBFloat(ima.sum)),
+		fmt.Sprintf("%s_min=%s", ima.field, influxDBFloat(ima.min)),
+		fmt.Sprintf("%s_max=%s", ima.field, influxDBFloat(ima.max)),
+		fmt.Sprintf("%s_mean=%s", ima.field, influxDBFloat(ima.sum/float64(ima.count))),
+	}
+
+	ima.count = 0
+	ima.sum = 0
+	return r
+}
+
+func (imh *InfluxDBHistogram) Observe(value float64) common.Histogram {
+
+	imh.observe(value)
+	return imh
+}
+
+// ObserveWithSpan observes value only, as line protocol has no exemplars
+func (imh *InfluxDBHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+
+	return imh.Observe(value)
+}
+
+func (im *InfluxDBMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return nil
+	}
+
+	r := im.register("histogram", m, &InfluxDBHistogram{influxDBAggregate{influxDBMetric: *m}})
+	if r == nil {
+		return nil
+	}
+	return r.(*InfluxDBHistogram)
+}
+
+func (im *InfluxDBMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	return im.Histogram(group, name, description, labels, prefixes...)
+}
+
+func (ims *InfluxDBSummary) Observe(value float64) common.Summary {
+
+	ims.observe(value)
+	return ims
+}
+
+func (im *InfluxDBMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	m, err := im.build(name, description, labels, prefixes...)
+	if err != nil {
+		im.logger.Error(err)
+		return nil
+	}
+
+	r := im.register("summary", m, &InfluxDBSummary{influxDBAggregate{influxDBMetric: *m}})
+	if r == nil {
+		return nil
+	}
+	return r.(*InfluxDBSummary)
+}
+
+func (im *InfluxDBMeter) Group(name string) common.Group {
+
+	return nil
+}
+
+// lines merges fields of the same measurement into one line
+func (im *InfluxDBMeter) lines(timestamp time.Time) []string {
+
+	measurements := make(map[string][]string)
+	im.series.Range(func(key, value interface{}) bool {
+		m := value.(influxDBField)
+		measurements[m.key()] = append(measurements[m.key()], m.fields()...)
+		return true
+	})
+
+	var lines []string
+	for measurement, fields := range measurements {
+		if len(fields) == 0 {
+			continue
+		}
+		sort.Strings(fields)
+		lines = append(lines, fmt.Sprintf("%s %s %d", measurement, strings.Join(fields, ","), timestamp.UnixNano()))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func (im *InfluxDBMeter) writeHTTP(lines []string) error {
+
+	u, err := url.Parse(fmt.Sprintf("%s/api/v2/write", strings.TrimSuffix(im.options.URL, "/")))
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("org", im.options.Org)
+	q.Set("bucket", im.options.Bucket)
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if !utils.IsEmpty(im.options.Token) {
+		req.Header.Set("Authorization", fmt.Sprintf("Token %s", im.options.Token))
+	}
+
+	resp, err := im.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("influxdb responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// writeUDP splits lines into packets, as there is no way to send large batch at once
+func (im *InfluxDBMeter) writeUDP(lines []string) error {
+
+	var bb bytes.Buffer
+	var errs []error
+
+	send := func() {
+		if bb.Len() == 0 {
+			return
+		}
+		if _, err := im.conn.Write(bb.Bytes()); err != nil {
+			errs = append(errs, err)
+		}
+		bb.Reset()
+	}
+
+	for _, line := range lines {
+		if bb.Len() > 0 && bb.Len()+1+len(line) > influxDBPacketSize {
+			send()
+		}
+		if bb.Len() > 0 {
+			bb.WriteByte('\n')
+		}
+		bb.WriteString(line)
+	}
+	send()
+	return errors.Join(errs...)
+}
+
+func (im *InfluxDBMeter) export() error {
+
+	lines := im.lines(time.Now())
+	if len(lines) == 0 {
+		return nil
+	}
+
+	started := time.Now()
+	err := im.write(lines)
+	common.GetTelemetry().Export("influxdb", common.TelemetryMetrics, started, err)
+	if err != nil {
+		common.GetTelemetry().Failed("influxdb", common.TelemetryMetrics, len(lines))
+		return err
+	}
+	common.GetTelemetry().Sent("influxdb", common.TelemetryMetrics, len(lines))
+	return nil
+}
+
+// Flush sends what is collected since the previous flush
+func (im *InfluxDBMeter) Flush(ctx context.Context) error {
+	return waitContext(ctx, im.export)
+}
+
+func (im *InfluxDBMeter) flush() {
+
+	defer im.wg.Done()
+
+	ticker := time.NewTicker(im.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-im.stop:
+			return
+		case <-ticker.C:
+			if err := im.export(); err != nil {
+				im.logger.Error(err)
+			}
+		}
+	}
+}
+
+func (im *InfluxDBMeter) Stop() {
+
+	err := im.Shutdown(context.Background())
+	if err != nil {
+		im.logger.Error(err)
+	}
+}
+
+// Shutdown stops flushing by interval and sends the rest of points
+func (im *InfluxDBMeter) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+
+		var err error
+		im.once.Do(func() {
+			close(im.stop)
+			im.wg.Wait()
+			err = im.export()
+
+			if im.conn != nil {
+				err = errors.Join(err, im.conn.Close())
+			}
+		})
+		return err
+	})
+}
+
+func NewInfluxDBMeter(options InfluxDBOptions, logger common.Logger, stdout *Stdout) *InfluxDBMeter {
+
+	if logger == nil {
+		logger = stdout
+	}
+
+	if utils.IsEmpty(options.URL) {
+		stdout.Debug("InfluxDB meter is disabled.")
+		return nil
+	}
+
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = InfluxDBDefaultFlushInterval
+	}
+
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	im := &InfluxDBMeter{
+		options: options,
+		logger:  logger,
+		series:  &sync.Map{},
+		stop:    make(chan struct{}),
+	}
+
+	switch u.Scheme {
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			logger.Error(err)
+			return nil
+		}
+		im.conn = conn
+		im.write = im.writeUDP
+	case "http", "https":
+		im.client = &http.Client{Timeout: influxDBTimeout}
+		im.write = im.writeHTTP
+	default:
+		logger.Error("InfluxDB scheme %s is not supported", u.Scheme)
+		return nil
+	}
+
+	im.wg.Add(1)
+	go im.flush()
+
+	logger.Info("InfluxDB meter is up...")
+	return im
+}
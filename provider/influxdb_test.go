@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsext/sre/common"
+)
+
+var influxDBTestTimestamp = regexp.MustCompile(` \d+$`)
+
+func influxDBNewStdout(t *testing.T) *Stdout {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+	return stdout
+}
+
+func influxDBTestLines(body string) []string {
+
+	var lines []string
+	for _, l := range strings.Split(body, "\n") {
+		if l == "" {
+			continue
+		}
+		lines = append(lines, influxDBTestTimestamp.ReplaceAllString(l, ""))
+	}
+	return lines
+}
+
+func TestInfluxDBMeterHTTP(t *testing.T) {
+
+	var mutex sync.Mutex
+	var bodies []string
+	var query, auth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		query = r.URL.Path + "?" + r.URL.RawQuery
+		auth = r.Header.Get("Authorization")
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	influxdb := NewInfluxDBMeter(InfluxDBOptions{
+		URL:           server.URL,
+		Org:           "iot",
+		Bucket:        "sensors",
+		Token:         "secret",
+		Prefix:        "test",
+		Tags:          "env=dev",
+		FlushInterval: time.Hour,
+	}, nil, influxDBNewStdout(t))
+	if influxdb == nil {
+		t.Fatal("Invalid influxdb")
+	}
+
+	labels := common.Labels{"device": "a b", "empty": ""}
+	influxdb.Counter("", "requests", "Requests", labels, "http").Add(2).Inc()
+	influxdb.FloatCounter("", "bytes", "Bytes", labels, "http").Add(1.5)
+	influxdb.Gauge("", "temperature", "Temperature", labels, "sensor").Set(20).Dec()
+	influxdb.ObservableGauge("", "uptime", "Uptime", nil, func() float64 { return 7 })
+
+	histogram := influxdb.Histogram("", "latency", "Latency", labels, "http")
+	histogram.Observe(1).Observe(3)
+	influxdb.Summary("", "size", "Size", labels, nil, time.Minute, "http").Observe(4)
+
+	if influxdb.Gauge("", "requests", "Requests", labels, "http") != nil {
+		t.Fatal("Gauge is registered over counter")
+	}
+
+	influxdb.Stop()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(bodies) != 1 {
+		t.Fatalf("Wrong number of writes: %d", len(bodies))
+	}
+	if query != "/api/v2/write?bucket=sensors&org=iot&precision=ns" {
+		t.Fatalf("Wrong query: %s", query)
+	}
+	if auth != "Token secret" {
+		t.Fatalf("Wrong authorization: %s", auth)
+	}
+
+	expected := []string{
+		`test,env=dev uptime=7`,
+		`test_http,device=a\ b,env=dev bytes=1.5,latency_count=2i,latency_max=3,latency_mean=2,latency_min=1,latency_sum=4,requests=3i,size_count=1i,size_max=4,size_mean=4,size_min=4,size_sum=4`,
+		`test_sensor,device=a\ b,env=dev temperature=19`,
+	}
+	lines := influxDBTestLines(bodies[0])
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Wrong lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestInfluxDBMeterUDP(t *testing.T) {
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	influxdb := NewInfluxDBMeter(InfluxDBOptions{
+		URL:           "udp://" + server.LocalAddr().String(),
+		FlushInterval: time.Hour,
+	}, nil, influxDBNewStdout(t))
+	if influxdb == nil {
+		t.Fatal("Invalid influxdb")
+	}
+
+	influxdb.Counter("", "events", "Events", nil).Inc()
+
+	// aggregates without observations are not written
+	influxdb.Histogram("", "idle", "Idle", nil)
+	influxdb.Stop()
+
+	buf := make([]byte, 65536)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := influxDBTestLines(string(buf[:n]))
+	if len(lines) != 1 || lines[0] != "events value=1i" {
+		t.Fatalf("Wrong lines: %v", lines)
+	}
+}
+
+func TestInfluxDBMeterWrongURL(t *testing.T) {
+
+	stdout := influxDBNewStdout(t)
+
+	if NewInfluxDBMeter(InfluxDBOptions{}, nil, stdout) != nil {
+		t.Fatal("Valid influxdb")
+	}
+	if NewInfluxDBMeter(InfluxDBOptions{URL: "tcp://localhost:8086"}, nil, stdout) != nil {
+		t.Fatal("Valid influxdb with unknown scheme")
+	}
+}
+
+func TestInfluxDBMeterShutdown(t *testing.T) {
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bucket") == "slow" {
+			<-release
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	failed := NewInfluxDBMeter(InfluxDBOptions{URL: server.URL, Bucket: "failed", FlushInterval: time.Hour}, nil, influxDBNewStdout(t))
+	failed.Counter("", "requests", "Requests", nil).Inc()
+	if err := failed.Shutdown(context.Background()); err == nil {
+		t.Fatal("Write error is not reported")
+	}
+	if err := failed.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Second shutdown is failed: %v", err)
+	}
+
+	slow := NewInfluxDBMeter(InfluxDBOptions{URL: server.URL, Bucket: "slow", FlushInterval: time.Hour}, nil, influxDBNewStdout(t))
+	slow.Counter("", "requests", "Requests", nil).Inc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := slow.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Deadline is not reported: %v", err)
+	}
+}
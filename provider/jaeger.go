@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/devopsext/sre/common"
@@ -14,6 +18,13 @@ import (
 	opentracingLog "github.com/opentracing/opentracing-go/log"
 	"github.com/uber/jaeger-client-go"
 	jaegerConfig "github.com/uber/jaeger-client-go/config"
+	jaegerTransport "github.com/uber/jaeger-client-go/transport"
+	jaegerUtils "github.com/uber/jaeger-client-go/utils"
+)
+
+const (
+	jaegerDefaultBufferFlushInterval = time.Second
+	jaegerDefaultQueueSize           = 100
 )
 
 type JaegerOptions struct {
@@ -46,9 +57,27 @@ type JaegerTracer struct {
 	options      JaegerOptions
 	callerOffset int
 	tracer       opentracing.Tracer
+	closer       io.Closer
+	reporter     *jaegerReporter
 	logger       common.Logger
 }
 
+type jaegerReporterItem struct {
+	span  *jaeger.Span
+	flush chan error
+	close chan struct{}
+}
+
+// jaegerReporter sends spans in background like jaeger remote reporter does, but it can be flushed on demand
+type jaegerReporter struct {
+	transport jaeger.Transport
+	logger    common.Logger
+	interval  time.Duration
+	queue     chan jaegerReporterItem
+	mutex     sync.RWMutex
+	closed    bool
+}
+
 type JaegerInternalLogger struct {
 	logger common.Logger
 }
@@ -253,6 +282,15 @@ func (j *JaegerTracer) StartSpan() common.TracerSpan {
 }
 
 func (j *JaegerTracer) StartSpanWithTraceID(traceID, spanID string) common.TracerSpan {
+	return j.startSpanWithTraceID(traceID, spanID, time.Now())
+}
+
+// StartSpanWithTraceIDAt starts span at time when it was created by traces
+func (j *JaegerTracer) StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) common.TracerSpan {
+	return j.startSpanWithTraceID(traceID, spanID, started)
+}
+
+func (j *JaegerTracer) startSpanWithTraceID(traceID, spanID string, started time.Time) common.TracerSpan {
 
 	tID := common.TraceIDHexToUint64(traceID)
 	if tID == 0 {
@@ -277,7 +315,7 @@ func (j *JaegerTracer) StartSpanWithTraceID(traceID, spanID string) common.Trace
 
 	newJaegerSpanCtx := jaeger.NewSpanContext(newTraceID, newSpanID, parentID, sampled, baggage)
 
-	s, ctx := j.startSpanFromContext(context.Background(), j.callerOffset+4, jaeger.SelfRef(newJaegerSpanCtx))
+	s, ctx := j.startSpanFromContext(context.Background(), j.callerOffset+5, jaeger.SelfRef(newJaegerSpanCtx), opentracing.StartTime(started))
 
 	return &JaegerSpan{
 		span:         s,
@@ -358,15 +396,199 @@ func (j *JaegerInternalLogger) Infof(msg string, args ...interface{}) {
 	}
 }
 
+func (j *JaegerTracer) Flush(ctx context.Context) error {
+
+	if j.reporter == nil {
+		return nil
+	}
+	return j.reporter.Flush(ctx)
+}
+
 func (j *JaegerTracer) Stop() {
-	// nothing here
+
+	err := j.Shutdown(context.Background())
+	if err != nil {
+		j.logger.Error(err)
+	}
+}
+
+// Shutdown closes reporter, which sends spans left in its queue
+func (j *JaegerTracer) Shutdown(ctx context.Context) error {
+
+	if j.closer == nil {
+		return nil
+	}
+	return waitContext(ctx, j.closer.Close)
 }
 
-func newJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout) opentracing.Tracer {
+func (jr *jaegerReporter) Report(span *jaeger.Span) {
+
+	jr.mutex.RLock()
+	defer jr.mutex.RUnlock()
+
+	if jr.closed {
+		return
+	}
+
+	select {
+	case jr.queue <- jaegerReporterItem{span: span.Retain()}:
+		common.GetTelemetry().Queued("jaeger", common.TelemetryTraces, 1)
+	default:
+		span.Release()
+		common.GetTelemetry().Dropped("jaeger", common.TelemetryTraces, 1)
+	}
+}
+
+// sent counts spans flushed by transport, which flushes on append when its buffer is full
+func (jr *jaegerReporter) sent(started time.Time, spans int, err error) error {
+
+	if spans == 0 && err == nil {
+		return nil
+	}
+
+	t := common.GetTelemetry()
+	t.Export("jaeger", common.TelemetryTraces, started, err)
+	if err != nil {
+		t.Failed("jaeger", common.TelemetryTraces, spans)
+		return err
+	}
+	t.Sent("jaeger", common.TelemetryTraces, spans)
+	return nil
+}
+
+func (jr *jaegerReporter) send() error {
+
+	started := time.Now()
+	spans, err := jr.transport.Flush()
+	return jr.sent(started, spans, err)
+}
+
+func (jr *jaegerReporter) run() {
+
+	ticker := time.NewTicker(jr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := jr.send(); err != nil {
+				jr.logger.Error(err)
+			}
+		case item := <-jr.queue:
+			switch {
+			case item.span != nil:
+				started := time.Now()
+				spans, err := jr.transport.Append(item.span)
+				if err := jr.sent(started, spans, err); err != nil {
+					jr.logger.Error(err)
+				}
+				item.span.Release()
+			case item.flush != nil:
+				item.flush <- jr.send()
+			case item.close != nil:
+				if err := jr.send(); err != nil {
+					jr.logger.Error(err)
+				}
+				close(item.close)
+				return
+			}
+		}
+	}
+}
+
+// Flush sends spans which are reported before the call
+func (jr *jaegerReporter) Flush(ctx context.Context) error {
+
+	done := make(chan error, 1)
+
+	jr.mutex.RLock()
+	if jr.closed {
+		jr.mutex.RUnlock()
+		return nil
+	}
+	select {
+	case jr.queue <- jaegerReporterItem{flush: done}:
+	case <-ctx.Done():
+	}
+	jr.mutex.RUnlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (jr *jaegerReporter) Close() {
+
+	jr.mutex.Lock()
+	if jr.closed {
+		jr.mutex.Unlock()
+		return
+	}
+	jr.closed = true
+	jr.mutex.Unlock()
+
+	done := make(chan struct{})
+	jr.queue <- jaegerReporterItem{close: done}
+	<-done
+
+	if err := jr.transport.Close(); err != nil {
+		jr.logger.Error(err)
+	}
+}
+
+func newJaegerReporter(options JaegerOptions, logger common.Logger) (*jaegerReporter, error) {
+
+	var transport jaeger.Transport
+	if !utils.IsEmpty(options.Endpoint) {
+		var httpOptions []jaegerTransport.HTTPOption
+		if !utils.IsEmpty(options.User) && !utils.IsEmpty(options.Password) {
+			httpOptions = append(httpOptions, jaegerTransport.HTTPBasicAuth(options.User, options.Password))
+		}
+		transport = jaegerTransport.NewHTTPTransport(options.Endpoint, httpOptions...)
+	} else {
+		var jaegerLogger jaeger.Logger = jaeger.NullLogger
+		if options.Debug {
+			jaegerLogger = &JaegerInternalLogger{logger: logger}
+		}
+		t, err := jaeger.NewUDPTransportWithParams(jaeger.UDPTransportParams{
+			AgentClientUDPParams: jaegerUtils.AgentClientUDPParams{
+				HostPort: net.JoinHostPort(options.AgentHost, strconv.Itoa(options.AgentPort)),
+				Logger:   jaegerLogger,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+
+	interval := time.Duration(options.BufferFlushInterval) * time.Second
+	if interval <= 0 {
+		interval = jaegerDefaultBufferFlushInterval
+	}
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = jaegerDefaultQueueSize
+	}
+
+	jr := &jaegerReporter{
+		transport: transport,
+		logger:    logger,
+		interval:  interval,
+		queue:     make(chan jaegerReporterItem, queueSize),
+	}
+	go jr.run()
+	return jr, nil
+}
+
+func newJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout) (opentracing.Tracer, io.Closer, *jaegerReporter) {
 
 	disabled := utils.IsEmpty(options.AgentHost) && utils.IsEmpty(options.Endpoint)
 	if disabled {
-		return nil
+		return nil, nil, nil
 	}
 
 	tags := make([]opentracing.Tag, 0)
@@ -387,37 +609,39 @@ func newJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout
 		Disabled:    disabled,
 		Tags:        tags,
 
-		// Use constant sampling to sample every trace
+		// Sample every trace, traces are sampled by common sampler before they come here
 		Sampler: &jaegerConfig.SamplerConfig{
 			Type:  jaeger.SamplerTypeConst,
 			Param: 1,
 		},
-
-		// Enable LogSpan to log every span via configured Logger
-		Reporter: &jaegerConfig.ReporterConfig{
-			LogSpans:            true,
-			User:                options.User,
-			Password:            options.Password,
-			LocalAgentHostPort:  fmt.Sprintf("%s:%d", options.AgentHost, options.AgentPort),
-			CollectorEndpoint:   options.Endpoint,
-			BufferFlushInterval: time.Duration(options.BufferFlushInterval) * time.Second,
-			QueueSize:           options.QueueSize,
-		},
 	}
 
 	var configOpts []jaegerConfig.Option
 
+	var spanLogger jaeger.Logger = jaeger.NullLogger
 	if options.Debug {
-		configOpts = append(configOpts, jaegerConfig.Logger(&JaegerInternalLogger{logger: logger}))
+		spanLogger = &JaegerInternalLogger{logger: logger}
+		configOpts = append(configOpts, jaegerConfig.Logger(spanLogger))
 	}
 
-	tracer, _, err := cfg.NewTracer(configOpts...)
+	reporter, err := newJaegerReporter(options, logger)
 	if err != nil {
 		stdout.Error(err)
-		return nil
+		return nil, nil, nil
+	}
+
+	// log every span via configured logger, which is silent without debug
+	jaegerReporter := jaeger.NewCompositeReporter(jaeger.NewLoggingReporter(spanLogger), reporter)
+	configOpts = append(configOpts, jaegerConfig.Reporter(jaegerReporter))
+
+	tracer, closer, err := cfg.NewTracer(configOpts...)
+	if err != nil {
+		reporter.Close()
+		stdout.Error(err)
+		return nil, nil, nil
 	}
 	opentracing.SetGlobalTracer(tracer)
-	return tracer
+	return tracer, closer, reporter
 }
 
 func NewJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout) *JaegerTracer {
@@ -426,7 +650,7 @@ func NewJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout
 		logger = stdout
 	}
 
-	tracer := newJaegerTracer(options, logger, stdout)
+	tracer, closer, reporter := newJaegerTracer(options, logger, stdout)
 	if tracer == nil {
 		stdout.Debug("Jaeger tracer is disabled.")
 		return nil
@@ -438,6 +662,8 @@ func NewJaegerTracer(options JaegerOptions, logger common.Logger, stdout *Stdout
 		options:      options,
 		callerOffset: 1,
 		tracer:       tracer,
+		closer:       closer,
+		reporter:     reporter,
 		logger:       logger,
 	}
 }
@@ -1,13 +1,18 @@
 package provider
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/devopsext/sre/common"
 	"github.com/devopsext/utils"
 	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
 )
 
 func jaegerNew(agentHost string) (*JaegerTracer, *Stdout) {
@@ -121,6 +126,78 @@ func TestJaeger(t *testing.T) {
 	}
 }
 
+func TestJaegerFlush(t *testing.T) {
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+	jaeger := NewJaegerTracer(JaegerOptions{
+		AgentHost:           "127.0.0.1",
+		AgentPort:           server.LocalAddr().(*net.UDPAddr).Port,
+		ServiceName:         "sre-jaeger-test",
+		BufferFlushInterval: 3600,
+	}, nil, stdout)
+	if jaeger == nil {
+		t.Fatal("Invalid jaeger")
+	}
+
+	jaeger.StartSpan().SetName("flushed-span").Finish()
+	if err := jaeger.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65000)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Span is not flushed: %v", err)
+	}
+	if !strings.Contains(string(buf[:n]), "flushed-span") {
+		t.Fatal("Wrong flushed span")
+	}
+
+	labels := common.Labels{"provider": "jaeger", "signal": common.TelemetryTraces}
+	if v := meter.CounterValue("telemetry_records_queued", labels); v != 1 {
+		t.Fatalf("Invalid queued spans %v, expected 1", v)
+	}
+	if v := meter.CounterValue("telemetry_records_sent", labels); v != 1 {
+		t.Fatalf("Invalid sent spans %v, expected 1", v)
+	}
+
+	if err := jaeger.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := jaeger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush after shutdown is failed: %v", err)
+	}
+}
+
+func TestJaegerReporterDropped(t *testing.T) {
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	// nobody reads the queue, so it is always full
+	reporter := &jaegerReporter{queue: make(chan jaegerReporterItem)}
+	tracer, _ := jaeger.NewTracer("sre-jaeger-test", jaeger.NewConstSampler(true), reporter)
+
+	tracer.StartSpan("dropped-span").Finish()
+
+	labels := common.Labels{"provider": "jaeger", "signal": common.TelemetryTraces}
+	if v := meter.CounterValue("telemetry_records_dropped", labels); v != 1 {
+		t.Fatalf("Invalid dropped spans %v, expected 1", v)
+	}
+}
+
 func TestJaegerWrongAgentHost(t *testing.T) {
 
 	jaeger, _ := jaegerNew("")
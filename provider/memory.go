@@ -0,0 +1,921 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	MemoryTraceIDHeader = "X-Memory-Trace-Id"
+	MemorySpanIDHeader  = "X-Memory-Span-Id"
+)
+
+const (
+	MemoryMetricCounter   = "counter"
+	MemoryMetricGauge     = "gauge"
+	MemoryMetricHistogram = "histogram"
+	MemoryMetricSummary   = "summary"
+)
+
+type MemoryLogEntry struct {
+	Level   string
+	Message string
+	TraceID string
+	SpanID  string
+	Time    time.Time
+}
+
+// MemoryLogger keeps log entries to check them in tests
+type MemoryLogger struct {
+	mutex   sync.Mutex
+	entries []MemoryLogEntry
+}
+
+type MemorySpanContext struct {
+	traceID string
+	spanID  string
+}
+
+type MemorySpan struct {
+	tracer   *MemoryTracer
+	context  *MemorySpanContext
+	parentID string
+	follows  bool
+	name     string
+	tags     map[string]interface{}
+	baggage  map[string]string
+	err      error
+	started  time.Time
+	finished time.Time
+}
+
+// MemoryTracer keeps started spans to check them in tests
+type MemoryTracer struct {
+	logger common.Logger
+	mutex  sync.Mutex
+	spans  []*MemorySpan
+}
+
+type MemoryMetric struct {
+	Kind         string
+	Name         string
+	Description  string
+	Labels       common.Labels
+	Value        float64
+	Observations []float64
+	callback     func() float64
+}
+
+type memoryCounter struct {
+	meter  *MemoryMeter
+	metric *MemoryMetric
+}
+
+type memoryGauge struct {
+	meter  *MemoryMeter
+	metric *MemoryMetric
+}
+
+type memoryHistogram struct {
+	meter  *MemoryMeter
+	metric *MemoryMetric
+}
+
+// MemoryMeter keeps metric values and observations to check them in tests
+type MemoryMeter struct {
+	logger  common.Logger
+	mutex   sync.Mutex
+	metrics map[string]*MemoryMetric
+}
+
+type MemoryEvent struct {
+	Name       string
+	Message    string
+	Attributes map[string]string
+	Begin      time.Time
+	End        time.Time
+}
+
+// MemoryEventer keeps events to check them in tests
+type MemoryEventer struct {
+	mutex  sync.Mutex
+	events []MemoryEvent
+}
+
+func (ml *MemoryLogger) log(level string, span common.TracerSpan, obj interface{}, args ...interface{}) string {
+
+	if obj == nil {
+		return ""
+	}
+
+	message := ""
+
+	switch v := obj.(type) {
+	case error:
+		message = v.Error()
+	case string:
+		message = v
+	default:
+		message = "not implemented"
+	}
+	message = prepare(message, args...)
+
+	entry := MemoryLogEntry{
+		Level:   level,
+		Message: message,
+		Time:    time.Now(),
+	}
+	if span != nil && span.GetContext() != nil {
+		entry.TraceID = span.GetContext().GetTraceID()
+		entry.SpanID = span.GetContext().GetSpanID()
+	}
+
+	ml.mutex.Lock()
+	ml.entries = append(ml.entries, entry)
+	ml.mutex.Unlock()
+	return message
+}
+
+func (ml *MemoryLogger) Info(obj interface{}, args ...interface{}) common.Logger {
+	ml.log("info", nil, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) SpanInfo(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
+	ml.log("info", span, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) Warn(obj interface{}, args ...interface{}) common.Logger {
+	ml.log("warn", nil, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) SpanWarn(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
+	ml.log("warn", span, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) Error(obj interface{}, args ...interface{}) common.Logger {
+	ml.log("error", nil, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) SpanError(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
+	ml.log("error", span, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) Debug(obj interface{}, args ...interface{}) common.Logger {
+	ml.log("debug", nil, obj, args...)
+	return ml
+}
+
+func (ml *MemoryLogger) SpanDebug(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
+	ml.log("debug", span, obj, args...)
+	return ml
+}
+
+// Panic keeps entry and panics as other loggers do
+func (ml *MemoryLogger) Panic(obj interface{}, args ...interface{}) {
+	if message := ml.log("panic", nil, obj, args...); message != "" {
+		panic(message)
+	}
+}
+
+func (ml *MemoryLogger) SpanPanic(span common.TracerSpan, obj interface{}, args ...interface{}) {
+	if message := ml.log("panic", span, obj, args...); message != "" {
+		panic(message)
+	}
+}
+
+func (ml *MemoryLogger) Stack(offset int) common.Logger {
+	return ml
+}
+
+func (ml *MemoryLogger) Entries() []MemoryLogEntry {
+
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	return append([]MemoryLogEntry{}, ml.entries...)
+}
+
+// Find returns entries of level which contain text, empty level means any
+func (ml *MemoryLogger) Find(level, text string) []MemoryLogEntry {
+
+	var r []MemoryLogEntry
+	for _, e := range ml.Entries() {
+		if !utils.IsEmpty(level) && e.Level != level {
+			continue
+		}
+		if strings.Contains(e.Message, text) {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+func (ml *MemoryLogger) Reset() {
+
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	ml.entries = nil
+}
+
+func (ml *MemoryLogger) Stop() {
+}
+
+func (ml *MemoryLogger) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (ml *MemoryLogger) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func NewMemoryLogger() *MemoryLogger {
+	return &MemoryLogger{}
+}
+
+func (msc *MemorySpanContext) GetTraceID() string {
+	return msc.traceID
+}
+
+func (msc *MemorySpanContext) GetSpanID() string {
+	return msc.spanID
+}
+
+func (ms *MemorySpan) GetContext() common.TracerSpanContext {
+	return ms.context
+}
+
+// SetCarrier injects span context into http headers
+func (ms *MemorySpan) SetCarrier(object interface{}) common.TracerSpan {
+
+	h, ok := object.(http.Header)
+	if ok {
+		h.Set(MemoryTraceIDHeader, ms.context.traceID)
+		h.Set(MemorySpanIDHeader, ms.context.spanID)
+	}
+	return ms
+}
+
+func (ms *MemorySpan) SetName(name string) common.TracerSpan {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	ms.name = name
+	return ms
+}
+
+func (ms *MemorySpan) SetTag(key string, value interface{}) common.TracerSpan {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	ms.tags[key] = value
+	return ms
+}
+
+func (ms *MemorySpan) SetBaggageItem(restrictedKey, value string) common.TracerSpan {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	ms.baggage[restrictedKey] = value
+	return ms
+}
+
+func (ms *MemorySpan) Error(err error) common.TracerSpan {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	ms.err = err
+	return ms
+}
+
+func (ms *MemorySpan) Finish() {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	if ms.finished.IsZero() {
+		ms.finished = time.Now()
+	}
+}
+
+func (ms *MemorySpan) Name() string {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	return ms.name
+}
+
+func (ms *MemorySpan) ParentID() string {
+	return ms.parentID
+}
+
+// FollowsFrom returns true if span was started by StartFollowSpan
+func (ms *MemorySpan) FollowsFrom() bool {
+	return ms.follows
+}
+
+func (ms *MemorySpan) Tag(key string) interface{} {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	return ms.tags[key]
+}
+
+func (ms *MemorySpan) Tags() map[string]interface{} {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	r := make(map[string]interface{})
+	for k, v := range ms.tags {
+		r[k] = v
+	}
+	return r
+}
+
+func (ms *MemorySpan) BaggageItem(key string) string {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	return ms.baggage[key]
+}
+
+func (ms *MemorySpan) Err() error {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	return ms.err
+}
+
+func (ms *MemorySpan) Finished() bool {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	return !ms.finished.IsZero()
+}
+
+// Duration returns zero until span is finished
+func (ms *MemorySpan) Duration() time.Duration {
+
+	ms.tracer.mutex.Lock()
+	defer ms.tracer.mutex.Unlock()
+
+	if ms.finished.IsZero() {
+		return 0
+	}
+	return ms.finished.Sub(ms.started)
+}
+
+func (mt *MemoryTracer) start(traceID, spanID, parentID string, follows bool, started time.Time) *MemorySpan {
+
+	span := &MemorySpan{
+		tracer:   mt,
+		context:  &MemorySpanContext{traceID: traceID, spanID: spanID},
+		parentID: parentID,
+		follows:  follows,
+		tags:     make(map[string]interface{}),
+		baggage:  make(map[string]string),
+		started:  started,
+	}
+
+	mt.mutex.Lock()
+	mt.spans = append(mt.spans, span)
+	mt.mutex.Unlock()
+	return span
+}
+
+func (mt *MemoryTracer) StartSpan() common.TracerSpan {
+	return mt.start(common.NewTraceID(), common.NewSpanID(), "", false, time.Now())
+}
+
+func (mt *MemoryTracer) StartSpanWithTraceID(traceID, spanID string) common.TracerSpan {
+	return mt.StartSpanWithTraceIDAt(traceID, spanID, time.Now())
+}
+
+// StartSpanWithTraceIDAt starts span at time when it was created by traces
+func (mt *MemoryTracer) StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) common.TracerSpan {
+
+	if utils.IsEmpty(traceID) {
+		mt.logger.Error(errors.New("invalid trace ID"))
+		return nil
+	}
+
+	if utils.IsEmpty(spanID) {
+		spanID = common.NewSpanID()
+	}
+	return mt.start(traceID, spanID, "", false, started)
+}
+
+// getSpanContext accepts http headers and span context of any tracer
+func (mt *MemoryTracer) getSpanContext(object interface{}) common.TracerSpanContext {
+
+	h, ok := object.(http.Header)
+	if ok {
+		traceID := h.Get(MemoryTraceIDHeader)
+		if utils.IsEmpty(traceID) {
+			mt.logger.Error(fmt.Errorf("no %s header", MemoryTraceIDHeader))
+			return nil
+		}
+		return &MemorySpanContext{traceID: traceID, spanID: h.Get(MemorySpanIDHeader)}
+	}
+
+	sc, ok := object.(common.TracerSpanContext)
+	if ok && sc != nil {
+		return sc
+	}
+	return nil
+}
+
+func (mt *MemoryTracer) StartChildSpan(object interface{}) common.TracerSpan {
+
+	sc := mt.getSpanContext(object)
+	if sc == nil {
+		return nil
+	}
+	return mt.start(sc.GetTraceID(), common.NewSpanID(), sc.GetSpanID(), false, time.Now())
+}
+
+func (mt *MemoryTracer) StartFollowSpan(object interface{}) common.TracerSpan {
+
+	sc := mt.getSpanContext(object)
+	if sc == nil {
+		return nil
+	}
+	return mt.start(sc.GetTraceID(), common.NewSpanID(), sc.GetSpanID(), true, time.Now())
+}
+
+// Spans returns spans in order of start
+func (mt *MemoryTracer) Spans() []*MemorySpan {
+
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	return append([]*MemorySpan{}, mt.spans...)
+}
+
+func (mt *MemoryTracer) FindSpans(name string) []*MemorySpan {
+
+	var r []*MemorySpan
+	for _, s := range mt.Spans() {
+		if s.Name() == name {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func (mt *MemoryTracer) Children(span *MemorySpan) []*MemorySpan {
+
+	var r []*MemorySpan
+	for _, s := range mt.Spans() {
+		if s.parentID == span.context.spanID && s.context.traceID == span.context.traceID {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func (mt *MemoryTracer) Reset() {
+
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	mt.spans = nil
+}
+
+func (mt *MemoryTracer) Stop() {
+}
+
+func (mt *MemoryTracer) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (mt *MemoryTracer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func NewMemoryTracer(logger common.Logger) *MemoryTracer {
+
+	if logger == nil {
+		logger = NewMemoryLogger()
+	}
+	return &MemoryTracer{logger: logger}
+}
+
+func memoryMetricKey(name string, labels common.Labels) string {
+
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var arr []string
+	for _, k := range keys {
+		arr = append(arr, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return fmt.Sprintf("%s{%s}", name, strings.Join(arr, ","))
+}
+
+// metric returns already registered metric of the same name and labels
+func (mm *MemoryMeter) metric(kind, name, description string, labels common.Labels, prefixes ...string) *MemoryMetric {
+
+	var names []string
+	names = append(names, prefixes...)
+	names = append(names, name)
+
+	newName, err := common.PrometheusMetricNaming.Name(names...)
+	if err != nil {
+		mm.logger.Error(err)
+		return nil
+	}
+
+	copied := make(common.Labels)
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	key := memoryMetricKey(newName, copied)
+	m, ok := mm.metrics[key]
+	if ok {
+		if m.Kind != kind {
+			mm.logger.Error("Memory %s %s is already registered as %s", kind, key, m.Kind)
+			return nil
+		}
+		return m
+	}
+
+	m = &MemoryMetric{
+		Kind:        kind,
+		Name:        newName,
+		Description: description,
+		Labels:      copied,
+	}
+	mm.metrics[key] = m
+	return m
+}
+
+func (mmc *memoryCounter) add(value float64) {
+
+	mmc.meter.mutex.Lock()
+	defer mmc.meter.mutex.Unlock()
+
+	mmc.metric.Value = mmc.metric.Value + value
+}
+
+func (mmc *memoryCounter) Inc() common.Counter {
+	return mmc.Add(1)
+}
+
+func (mmc *memoryCounter) Add(value int) common.Counter {
+	mmc.add(float64(value))
+	return mmc
+}
+
+func (mmc *memoryCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+	return mmc.Add(value)
+}
+
+func (mm *MemoryMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
+
+	m := mm.metric(MemoryMetricCounter, name, description, labels, prefixes...)
+	if m == nil {
+		return nil
+	}
+	return &memoryCounter{meter: mm, metric: m}
+}
+
+// memoryFloatCounter shares value with integer counter of the same name and labels
+type memoryFloatCounter struct {
+	*memoryCounter
+}
+
+func (mmfc *memoryFloatCounter) Add(value float64) common.FloatCounter {
+	mmfc.add(value)
+	return mmfc
+}
+
+func (mm *MemoryMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	m := mm.metric(MemoryMetricCounter, name, description, labels, prefixes...)
+	if m == nil {
+		return nil
+	}
+	return &memoryFloatCounter{&memoryCounter{meter: mm, metric: m}}
+}
+
+func (mmg *memoryGauge) add(value float64, set bool) common.Gauge {
+
+	mmg.meter.mutex.Lock()
+	defer mmg.meter.mutex.Unlock()
+
+	if set {
+		mmg.metric.Value = value
+	} else {
+		mmg.metric.Value = mmg.metric.Value + value
+	}
+	return mmg
+}
+
+func (mmg *memoryGauge) Set(value float64) common.Gauge {
+	return mmg.add(value, true)
+}
+
+func (mmg *memoryGauge) Add(value float64) common.Gauge {
+	return mmg.add(value, false)
+}
+
+func (mmg *memoryGauge) Sub(value float64) common.Gauge {
+	return mmg.add(-value, false)
+}
+
+func (mmg *memoryGauge) Inc() common.Gauge {
+	return mmg.Add(1)
+}
+
+func (mmg *memoryGauge) Dec() common.Gauge {
+	return mmg.Sub(1)
+}
+
+func (mm *MemoryMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+
+	m := mm.metric(MemoryMetricGauge, name, description, labels, prefixes...)
+	if m == nil {
+		return nil
+	}
+	return &memoryGauge{meter: mm, metric: m}
+}
+
+// ObservableGauge calls callback whenever gauge value is queried
+func (mm *MemoryMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	m := mm.metric(MemoryMetricGauge, name, description, labels, prefixes...)
+	if m == nil {
+		return
+	}
+
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	m.callback = callback
+}
+
+func (mmh *memoryHistogram) observe(value float64) {
+
+	mmh.meter.mutex.Lock()
+	defer mmh.meter.mutex.Unlock()
+
+	mmh.metric.Observations = append(mmh.metric.Observations, value)
+}
+
+func (mmh *memoryHistogram) Observe(value float64) common.Histogram {
+	mmh.observe(value)
+	return mmh
+}
+
+func (mmh *memoryHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+	return mmh.Observe(value)
+}
+
+func (mm *MemoryMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+
+	m := mm.metric(MemoryMetricHistogram, name, description, labels, prefixes...)
+	if m == nil {
+		return nil
+	}
+	return &memoryHistogram{meter: mm, metric: m}
+}
+
+func (mm *MemoryMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+	return mm.Histogram(group, name, description, labels, prefixes...)
+}
+
+type memorySummary struct {
+	*memoryHistogram
+}
+
+func (mms *memorySummary) Observe(value float64) common.Summary {
+	mms.observe(value)
+	return mms
+}
+
+func (mm *MemoryMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	m := mm.metric(MemoryMetricSummary, name, description, labels, prefixes...)
+	if m == nil {
+		return nil
+	}
+	return &memorySummary{&memoryHistogram{meter: mm, metric: m}}
+}
+
+func (mm *MemoryMeter) Group(name string) common.Group {
+	return nil
+}
+
+// copy returns metric copy which can be read without lock, except its callback
+func (m *MemoryMetric) copy() *MemoryMetric {
+
+	r := *m
+	r.Observations = append([]float64{}, m.Observations...)
+	return &r
+}
+
+// observe takes value of observable metric, must be called without lock as callback may use meter
+func (m *MemoryMetric) observe() *MemoryMetric {
+
+	if m.callback != nil {
+		m.Value = m.callback()
+	}
+	return m
+}
+
+// Metric returns copy of metric by name with prefixes joined by underscore, nil if it doesn't exist
+func (mm *MemoryMeter) Metric(name string, labels common.Labels) *MemoryMetric {
+
+	mm.mutex.Lock()
+	m, ok := mm.metrics[memoryMetricKey(name, labels)]
+	if !ok {
+		mm.mutex.Unlock()
+		return nil
+	}
+	r := m.copy()
+	mm.mutex.Unlock()
+
+	return r.observe()
+}
+
+func (mm *MemoryMeter) value(kind, name string, labels common.Labels) float64 {
+
+	m := mm.Metric(name, labels)
+	if m == nil || m.Kind != kind {
+		return 0
+	}
+	return m.Value
+}
+
+func (mm *MemoryMeter) CounterValue(name string, labels common.Labels) float64 {
+	return mm.value(MemoryMetricCounter, name, labels)
+}
+
+func (mm *MemoryMeter) GaugeValue(name string, labels common.Labels) float64 {
+	return mm.value(MemoryMetricGauge, name, labels)
+}
+
+// Observations returns values observed by histogram or summary
+func (mm *MemoryMeter) Observations(name string, labels common.Labels) []float64 {
+
+	m := mm.Metric(name, labels)
+	if m == nil {
+		return nil
+	}
+	return m.Observations
+}
+
+// Metrics returns copies of all metrics sorted by name and labels
+func (mm *MemoryMeter) Metrics() []*MemoryMetric {
+
+	mm.mutex.Lock()
+	var keys []string
+	for k := range mm.metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var r []*MemoryMetric
+	for _, k := range keys {
+		r = append(r, mm.metrics[k].copy())
+	}
+	mm.mutex.Unlock()
+
+	for _, m := range r {
+		m.observe()
+	}
+	return r
+}
+
+func (mm *MemoryMeter) Reset() {
+
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	mm.metrics = make(map[string]*MemoryMetric)
+}
+
+func (mm *MemoryMeter) Stop() {
+}
+
+func (mm *MemoryMeter) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (mm *MemoryMeter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func NewMemoryMeter(logger common.Logger) *MemoryMeter {
+
+	if logger == nil {
+		logger = NewMemoryLogger()
+	}
+	return &MemoryMeter{
+		logger:  logger,
+		metrics: make(map[string]*MemoryMetric),
+	}
+}
+
+func (me *MemoryEventer) Interval(name string, message string, attributes map[string]string, begin, end time.Time) error {
+
+	copied := make(map[string]string)
+	for k, v := range attributes {
+		copied[k] = v
+	}
+
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.events = append(me.events, MemoryEvent{
+		Name:       name,
+		Message:    message,
+		Attributes: copied,
+		Begin:      begin,
+		End:        end,
+	})
+	return nil
+}
+
+func (me *MemoryEventer) Now(name string, message string, attributes map[string]string) error {
+	return me.At(name, message, attributes, time.Now())
+}
+
+func (me *MemoryEventer) At(name string, message string, attributes map[string]string, when time.Time) error {
+	return me.Interval(name, message, attributes, when, when)
+}
+
+func (me *MemoryEventer) Events() []MemoryEvent {
+
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	return append([]MemoryEvent{}, me.events...)
+}
+
+func (me *MemoryEventer) FindEvents(name string) []MemoryEvent {
+
+	var r []MemoryEvent
+	for _, e := range me.Events() {
+		if e.Name == name {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+func (me *MemoryEventer) Reset() {
+
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.events = nil
+}
+
+func (me *MemoryEventer) Stop() {
+}
+
+func (me *MemoryEventer) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (me *MemoryEventer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func NewMemoryEventer() *MemoryEventer {
+	return &MemoryEventer{}
+}
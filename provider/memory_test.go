@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/devopsext/sre/common"
+)
+
+func TestMemoryLogger(t *testing.T) {
+
+	logger := NewMemoryLogger()
+	tracer := NewMemoryTracer(logger)
+	span := tracer.StartSpan()
+
+	logger.Info("started %d", 1).Warn(nil).Error(errors.New("failed"))
+	logger.SpanDebug(span, "inside span")
+
+	if len(logger.Entries()) != 3 {
+		t.Fatalf("Wrong number of entries: %d", len(logger.Entries()))
+	}
+	if e := logger.Find("info", "started"); len(e) != 1 || e[0].Message != "started 1" {
+		t.Fatalf("Wrong info entries: %v", e)
+	}
+	if e := logger.Find("", "fail"); len(e) != 1 || e[0].Level != "error" {
+		t.Fatalf("Wrong error entries: %v", e)
+	}
+	if e := logger.Find("debug", ""); len(e) != 1 || e[0].TraceID != span.GetContext().GetTraceID() {
+		t.Fatalf("Wrong span entries: %v", e)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("It should be paniced")
+			}
+		}()
+		logger.Panic("panic")
+	}()
+
+	logger.Reset()
+	if len(logger.Entries()) != 0 {
+		t.Fatal("Entries are not reset")
+	}
+}
+
+func TestMemoryTracer(t *testing.T) {
+
+	logger := NewMemoryLogger()
+	tracer := NewMemoryTracer(logger)
+
+	root := tracer.StartSpan().SetName("root").SetTag("user", "alice")
+	child := tracer.StartChildSpan(root.GetContext()).SetName("child").Error(errors.New("failed"))
+	child.Finish()
+
+	headers := http.Header{}
+	root.SetCarrier(headers)
+	remote := tracer.StartFollowSpan(headers).SetName("remote")
+	root.Finish()
+
+	if tracer.StartSpanWithTraceID("", "") != nil {
+		t.Fatal("Span with empty trace ID is started")
+	}
+	if len(logger.Find("error", "invalid trace ID")) != 1 {
+		t.Fatal("Invalid trace ID is not logged")
+	}
+	if tracer.StartChildSpan(http.Header{}) != nil {
+		t.Fatal("Span without headers is started")
+	}
+
+	spans := tracer.FindSpans("root")
+	if len(spans) != 1 || spans[0].Tag("user") != "alice" || !spans[0].Finished() {
+		t.Fatalf("Wrong root span: %v", spans)
+	}
+
+	children := tracer.Children(spans[0])
+	if len(children) != 2 {
+		t.Fatalf("Wrong number of children: %d", len(children))
+	}
+	if children[0].Name() != "child" || children[0].Err() == nil || children[0].FollowsFrom() {
+		t.Fatal("Wrong child span")
+	}
+	if children[1] != remote || !children[1].FollowsFrom() || children[1].Finished() {
+		t.Fatal("Wrong remote span")
+	}
+	if remote.GetContext().GetTraceID() != root.GetContext().GetTraceID() {
+		t.Fatal("Trace ID is not propagated by headers")
+	}
+}
+
+func TestMemoryMeter(t *testing.T) {
+
+	meter := NewMemoryMeter(nil)
+
+	metrics := common.NewMetrics()
+	metrics.Register(meter)
+
+	labels := common.Labels{"code": "200"}
+	metrics.Counter("", "requests", "Requests", labels, "http").Add(2).Inc()
+	metrics.FloatCounter("", "requests", "Requests", labels, "http").Add(0.5)
+	metrics.Gauge("", "load", "Load", nil).Set(3).Dec()
+	metrics.Histogram("", "latency", "Latency", labels, "http").Observe(1).Observe(2)
+	metrics.Summary("", "size", "Size", nil, nil, time.Minute).Observe(5)
+
+	value := 1.0
+	meter.ObservableGauge("", "queue", "Queue", nil, func() float64 { return value })
+	value = 7
+
+	if v := meter.CounterValue("http_requests", labels); v != 3.5 {
+		t.Fatalf("Wrong counter value: %v", v)
+	}
+	if v := meter.CounterValue("http_requests", nil); v != 0 {
+		t.Fatalf("Wrong counter value without labels: %v", v)
+	}
+	if v := meter.GaugeValue("load", nil); v != 2 {
+		t.Fatalf("Wrong gauge value: %v", v)
+	}
+	if v := meter.GaugeValue("queue", nil); v != 7 {
+		t.Fatalf("Wrong observable gauge value: %v", v)
+	}
+	if o := meter.Observations("http_latency", labels); len(o) != 2 || o[1] != 2 {
+		t.Fatalf("Wrong observations: %v", o)
+	}
+	if o := meter.Observations("size", nil); len(o) != 1 {
+		t.Fatalf("Wrong summary observations: %v", o)
+	}
+
+	if meter.Gauge("", "requests", "Requests", labels, "http") != nil {
+		t.Fatal("Gauge is registered over counter")
+	}
+	if len(meter.Metrics()) != 5 {
+		t.Fatalf("Wrong number of metrics: %d", len(meter.Metrics()))
+	}
+
+	meter.Reset()
+	if meter.Metric("load", nil) != nil {
+		t.Fatal("Metrics are not reset")
+	}
+}
+
+func TestMemoryMeterReset(t *testing.T) {
+
+	meter := NewMemoryMeter(nil)
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			for j := 0; j < 10; j++ {
+				meter.Counter("", fmt.Sprintf("requests_%d", j), "", nil).Inc()
+			}
+			meter.Reset()
+		}
+	}()
+
+	// metrics are read while they are reset
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			meter.Metrics()
+		}
+	}
+}
+
+func TestMemoryEventer(t *testing.T) {
+
+	eventer := NewMemoryEventer()
+
+	events := common.NewEvents()
+	events.Register(eventer)
+
+	begin := time.Now().Add(-time.Minute)
+	events.Interval("deploy", "Deploy", map[string]string{"version": "1.0"}, begin, time.Now())
+	events.Now("restart", "Restart", nil)
+
+	if len(eventer.Events()) != 2 {
+		t.Fatalf("Wrong number of events: %d", len(eventer.Events()))
+	}
+
+	deploys := eventer.FindEvents("deploy")
+	if len(deploys) != 1 || deploys[0].Attributes["version"] != "1.0" || !deploys[0].Begin.Equal(begin) {
+		t.Fatalf("Wrong deploy events: %v", deploys)
+	}
+
+	restarts := eventer.FindEvents("restart")
+	if len(restarts) != 1 || !restarts[0].Begin.Equal(restarts[0].End) {
+		t.Fatalf("Wrong restart events: %v", restarts)
+	}
+}
@@ -2,9 +2,12 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/devopsext/sre/common"
@@ -30,10 +33,11 @@ type NewRelicTracerOptions struct {
 
 type NewRelicLoggerOptions struct {
 	NewRelicOptions
-	Endpoint  string
-	AgentHost string
-	AgentPort int
-	Level     string
+	Endpoint   string
+	AgentHost  string
+	AgentPort  int
+	Level      string
+	BufferSize int
 }
 
 type NewRelicMeterOptions struct {
@@ -65,16 +69,18 @@ type NewRelicTracerSpan struct {
 
 type NewRelicTracer struct {
 	options      NewRelicTracerOptions
-	harvester    *telemetry.Harvester
+	harvester    *NewRelicHarvester
 	logger       common.Logger
 	callerOffset int
+	tail         *common.TailSampler
 }
 
 type NewRelicLogger struct {
-	harvester    *telemetry.Harvester
-	connection   *net.TCPConn
+	harvester    *NewRelicHarvester
+	connection   *AgentWriter
 	stdout       *Stdout
 	log          *logrus.Logger
+	level        logrus.Level
 	options      NewRelicLoggerOptions
 	callerOffset int
 }
@@ -83,32 +89,217 @@ type NewRelicCounter struct {
 	meter       *NewRelicMeter
 	name        string
 	description string
-	labels      []string
+	count       *telemetry.AggregatedCount
+}
+
+type NewRelicFloatCounter struct {
+	meter       *NewRelicMeter
+	name        string
+	description string
+	count       *telemetry.AggregatedCount
 }
 
 type NewRelicGauge struct {
 	meter       *NewRelicMeter
 	name        string
 	description string
-	labels      []string
+	gauge       *telemetry.AggregatedGauge
+	value       MeterGaugeValue
+}
+
+type NewRelicHistogram struct {
+	meter       *NewRelicMeter
+	name        string
+	description string
+	summary     *telemetry.AggregatedSummary
+}
+
+type NewRelicSummary struct {
+	meter       *NewRelicMeter
+	name        string
+	description string
+	summary     *telemetry.AggregatedSummary
 }
 
 type NewRelicMeter struct {
-	harvester    *telemetry.Harvester
+	harvester    *NewRelicHarvester
 	options      NewRelicMeterOptions
 	logger       common.Logger
 	callerOffset int
+	gauges       *sync.Map
+	observables  *sync.Map
+	observer     *MeterObserver
 }
 
 type NewRelicEventer struct {
-	harvester  *telemetry.Harvester
+	harvester  *NewRelicHarvester
 	options    NewRelicEventerOptions
 	logger     common.Logger
 	attributes map[string]interface{}
 }
 
+// NewRelicHarvester harvests on its own period instead of telemetry SDK,
+// so records and errors of each harvest are known without reading request bodies
+type NewRelicHarvester struct {
+	*telemetry.Harvester
+	signal     string
+	records    int64
+	series     map[interface{}]bool
+	results    map[*http.Request]error
+	mutex      sync.Mutex
+	harvesting sync.Mutex
+	stop       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+type NewRelicTransport struct {
+	harvester *NewRelicHarvester
+	next      http.RoundTripper
+}
+
 const NewRelicHeaderTraceID string = "X-Trace-ID"
 const NewRelicHeaderSpanID string = "X-Span-ID"
+const newRelicHarvestPeriod = time.Second * 5
+
+func (nrt *NewRelicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	started := time.Now()
+	resp, err := nrt.next.RoundTrip(req)
+
+	exportErr := err
+	if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		exportErr = fmt.Errorf("HTTP error %d", resp.StatusCode)
+	}
+	common.GetTelemetry().Export("newrelic", nrt.harvester.signal, started, exportErr)
+
+	// request is retried by the same pointer, so the last attempt wins
+	nrt.harvester.mutex.Lock()
+	nrt.harvester.results[req] = exportErr
+	nrt.harvester.mutex.Unlock()
+
+	return resp, err
+}
+
+func (nrh *NewRelicHarvester) recorded(err error) error {
+
+	if err != nil {
+		common.GetTelemetry().Dropped("newrelic", nrh.signal, 1)
+		return err
+	}
+	atomic.AddInt64(&nrh.records, 1)
+	common.GetTelemetry().Queued("newrelic", nrh.signal, 1)
+	return nil
+}
+
+func (nrh *NewRelicHarvester) RecordSpan(span telemetry.Span) error {
+	return nrh.recorded(nrh.Harvester.RecordSpan(span))
+}
+
+func (nrh *NewRelicHarvester) RecordLog(log telemetry.Log) error {
+	return nrh.recorded(nrh.Harvester.RecordLog(log))
+}
+
+func (nrh *NewRelicHarvester) RecordEvent(event telemetry.Event) error {
+	return nrh.recorded(nrh.Harvester.RecordEvent(event))
+}
+
+// touch marks aggregated metric as updated, it's sent once per harvest
+func (nrh *NewRelicHarvester) touch(series interface{}) {
+
+	nrh.mutex.Lock()
+	nrh.series[series] = true
+	nrh.mutex.Unlock()
+}
+
+// Harvest sends records and reports them as sent or failed, harvest is cancelled when ctx is done
+func (nrh *NewRelicHarvester) Harvest(ctx context.Context) error {
+
+	nrh.harvesting.Lock()
+	defer nrh.harvesting.Unlock()
+
+	records := int(atomic.SwapInt64(&nrh.records, 0))
+	nrh.mutex.Lock()
+	records = records + len(nrh.series)
+	nrh.series = make(map[interface{}]bool)
+	nrh.mutex.Unlock()
+
+	nrh.Harvester.HarvestNow(ctx)
+
+	var errs []error
+	nrh.mutex.Lock()
+	for _, err := range nrh.results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	nrh.results = make(map[*http.Request]error)
+	nrh.mutex.Unlock()
+
+	err := errors.Join(errs...)
+	if err != nil {
+		common.GetTelemetry().Failed("newrelic", nrh.signal, records)
+		return err
+	}
+	common.GetTelemetry().Sent("newrelic", nrh.signal, records)
+	return nil
+}
+
+func (nrh *NewRelicHarvester) run() {
+
+	defer nrh.wg.Done()
+
+	ticker := time.NewTicker(newRelicHarvestPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-nrh.stop:
+			return
+		case <-ticker.C:
+			nrh.Harvest(context.Background())
+		}
+	}
+}
+
+// Stop stops periodic harvest and harvests the rest
+func (nrh *NewRelicHarvester) Stop(ctx context.Context) error {
+
+	nrh.stopOnce.Do(func() {
+		close(nrh.stop)
+	})
+	nrh.wg.Wait()
+	return nrh.Harvest(ctx)
+}
+
+func newRelicHarvester(signal string, cfgs ...func(*telemetry.Config)) (*NewRelicHarvester, error) {
+
+	nrh := &NewRelicHarvester{
+		signal:  signal,
+		series:  make(map[interface{}]bool),
+		results: make(map[*http.Request]error),
+		stop:    make(chan struct{}),
+	}
+
+	cfgs = append(cfgs, telemetry.ConfigHarvestPeriod(0), func(cfg *telemetry.Config) {
+		cfg.Client = &http.Client{
+			Transport: &NewRelicTransport{
+				harvester: nrh,
+				next:      http.DefaultTransport,
+			},
+		}
+	})
+
+	harvester, err := telemetry.NewHarvester(cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	nrh.Harvester = harvester
+
+	nrh.wg.Add(1)
+	go nrh.run()
+	return nrh, nil
+}
 
 func (nrtsc *NewRelicTracerSpanContext) GetTraceID() string {
 
@@ -207,16 +398,24 @@ func (nrts *NewRelicTracerSpan) Finish() {
 		ParentID:    nrts.parentID,
 		Name:        nrts.operation,
 		Timestamp:   nrts.timestamp,
-		Duration:    time.Second,
+		Duration:    time.Since(nrts.timestamp),
 		ServiceName: nrts.tracer.options.ServiceName,
 		Attributes:  nrts.attributes,
 		Events:      nrts.events,
 	}
 
-	err := nrts.tracer.harvester.RecordSpan(span)
-	if err != nil {
-		nrts.tracer.logger.Error(err)
-	}
+	nrts.tracer.tail.Add(common.TailSamplerSpan{
+		TraceID:  span.TraceID,
+		Name:     span.Name,
+		Duration: span.Duration,
+		Error:    nrts.attributes["status"] == "error",
+		Tags:     span.Attributes,
+	}, func() {
+		err := nrts.tracer.harvester.RecordSpan(span)
+		if err != nil {
+			nrts.tracer.logger.Error(err)
+		}
+	})
 }
 
 func (nrt *NewRelicTracer) getSpanAttributes() (string, map[string]interface{}) {
@@ -257,6 +456,21 @@ func (nrt *NewRelicTracer) StartSpanWithTraceID(traceID, spanID string) common.T
 	}
 }
 
+// StartSpanWithTraceIDAt starts span at time when it was created by traces
+func (nrt *NewRelicTracer) StartSpanWithTraceIDAt(traceID, spanID string, started time.Time) common.TracerSpan {
+
+	operation, attributes := nrt.getSpanAttributes()
+
+	return &NewRelicTracerSpan{
+		traceID:    traceID,
+		spanID:     spanID,
+		operation:  operation,
+		timestamp:  started,
+		attributes: attributes,
+		tracer:     nrt,
+	}
+}
+
 func (nrt *NewRelicTracer) getParentSpanID(object interface{}) (string, string) {
 
 	h, ok := object.(http.Header)
@@ -321,11 +535,37 @@ func (nrt *NewRelicTracer) SetCallerOffset(offset int) {
 	nrt.callerOffset = offset
 }
 
+// SetTailSampler holds finished spans until their trace is kept or dropped
+func (nrt *NewRelicTracer) SetTailSampler(s *common.TailSampler) {
+	nrt.tail = s
+}
+
 func (nrt *NewRelicTracer) Stop() {
 
 	if nrt.harvester != nil {
-		nrt.harvester.HarvestNow(context.Background())
+		nrt.harvester.Stop(context.Background())
+	}
+}
+
+func (nrt *NewRelicTracer) Flush(ctx context.Context) error {
+
+	if nrt.harvester != nil {
+		if err := nrt.harvester.Harvest(ctx); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Shutdown harvests buffered spans, harvest is cancelled when ctx is done
+func (nrt *NewRelicTracer) Shutdown(ctx context.Context) error {
+
+	if nrt.harvester != nil {
+		if err := nrt.harvester.Stop(ctx); err != nil {
+			return err
+		}
 	}
+	return ctx.Err()
 }
 
 func NewNewRelicTracer(options NewRelicTracerOptions, logger common.Logger, stdout *Stdout) *NewRelicTracer {
@@ -359,7 +599,7 @@ func NewNewRelicTracer(options NewRelicTracerOptions, logger common.Logger, stdo
 		)
 	}
 
-	harvester, err := telemetry.NewHarvester(cfgs...)
+	harvester, err := newRelicHarvester(common.TelemetryTraces, cfgs...)
 	if err != nil {
 		stdout.Error(err)
 		return nil
@@ -415,129 +655,91 @@ func (nr *NewRelicLogger) logToApi(level, message string, fields logrus.Fields)
 	return false
 }
 
-func (nr *NewRelicLogger) Info(obj interface{}, args ...interface{}) common.Logger {
+func (nr *NewRelicLogger) send(level logrus.Level, span common.TracerSpan, obj interface{}, args ...interface{}) {
 
-	if exists, fields, message := nr.exists(logrus.InfoLevel, obj, args...); exists {
-		if nr.log != nil {
-			nr.log.WithFields(fields).Infoln(message)
-		} else {
-			nr.logToApi("info", message, fields)
-		}
+	exists, fields, message := nr.exists(level, obj, args...)
+	if !exists {
+		return
+	}
+	fields = nr.addSpanFields(span, fields)
+
+	if nr.log != nil {
+		nr.log.WithFields(fields).Logln(level, message)
+		return
+	}
+
+	name := level.String()
+	if level == logrus.WarnLevel {
+		name = "warn"
+	}
+	nr.logToApi(name, message, fields)
+
+	if level != logrus.PanicLevel {
+		return
 	}
+	if span != nil {
+		nr.stdout.SpanPanic(span, message)
+		return
+	}
+	nr.stdout.Panic(message)
+}
+
+func (nr *NewRelicLogger) Info(obj interface{}, args ...interface{}) common.Logger {
+
+	nr.send(logrus.InfoLevel, nil, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) SpanInfo(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.InfoLevel, obj, args...); exists {
-		fields = nr.addSpanFields(span, fields)
-		if nr.log != nil {
-			nr.log.WithFields(fields).Infoln(message)
-		} else {
-			nr.logToApi("info", message, fields)
-		}
-	}
+	nr.send(logrus.InfoLevel, span, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) Warn(obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.WarnLevel, obj, args...); exists {
-		if nr.log != nil {
-			nr.log.WithFields(fields).Warnln(message)
-		} else {
-			nr.logToApi("warn", message, fields)
-		}
-	}
+	nr.send(logrus.WarnLevel, nil, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) SpanWarn(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.WarnLevel, obj, args...); exists {
-		fields = nr.addSpanFields(span, fields)
-		if nr.log != nil {
-			nr.log.WithFields(fields).Warnln(message)
-		} else {
-			nr.logToApi("warn", message, fields)
-		}
-	}
+	nr.send(logrus.WarnLevel, span, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) Error(obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.ErrorLevel, obj, args...); exists {
-		if nr.log != nil {
-			nr.log.WithFields(fields).Errorln(message)
-		} else {
-			nr.logToApi("error", message, fields)
-		}
-	}
+	nr.send(logrus.ErrorLevel, nil, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) SpanError(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.ErrorLevel, obj, args...); exists {
-		fields = nr.addSpanFields(span, fields)
-		if nr.log != nil {
-			nr.log.WithFields(fields).Errorln(message)
-		} else {
-			nr.logToApi("error", message, fields)
-		}
-	}
+	nr.send(logrus.ErrorLevel, span, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) Debug(obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.DebugLevel, obj, args...); exists {
-		if nr.log != nil {
-			nr.log.WithFields(fields).Debugln(message)
-		} else {
-			nr.logToApi("debug", message, fields)
-		}
-	}
+	nr.send(logrus.DebugLevel, nil, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) SpanDebug(span common.TracerSpan, obj interface{}, args ...interface{}) common.Logger {
 
-	if exists, fields, message := nr.exists(logrus.DebugLevel, obj, args...); exists {
-		fields = nr.addSpanFields(span, fields)
-		if nr.log != nil {
-			nr.log.WithFields(fields).Debugln(message)
-		} else {
-			nr.logToApi("debug", message, fields)
-		}
-	}
+	nr.send(logrus.DebugLevel, span, obj, args...)
 	return nr
 }
 
 func (nr *NewRelicLogger) Panic(obj interface{}, args ...interface{}) {
 
-	if exists, fields, message := nr.exists(logrus.PanicLevel, obj, args...); exists {
-		if nr.log != nil {
-			nr.log.WithFields(fields).Panicln(message)
-		} else {
-			nr.logToApi("panic", message, fields)
-			nr.stdout.Panic(message)
-		}
-	}
+	nr.send(logrus.PanicLevel, nil, obj, args...)
 }
 
 func (nr *NewRelicLogger) SpanPanic(span common.TracerSpan, obj interface{}, args ...interface{}) {
 
-	if exists, fields, message := nr.exists(logrus.PanicLevel, obj, args...); exists {
-		fields = nr.addSpanFields(span, fields)
-		if nr.log != nil {
-			nr.log.WithFields(fields).Panicln(message)
-		} else {
-			nr.logToApi("panic", message, fields)
-			nr.stdout.SpanPanic(span, message)
-		}
-	}
+	nr.send(logrus.PanicLevel, span, obj, args...)
 }
 
 func (nr *NewRelicLogger) Stack(offset int) common.Logger {
@@ -547,6 +749,10 @@ func (nr *NewRelicLogger) Stack(offset int) common.Logger {
 
 func (nr *NewRelicLogger) exists(level logrus.Level, obj interface{}, args ...interface{}) (bool, logrus.Fields, string) {
 
+	if obj == nil || level > nr.level {
+		return false, nil, ""
+	}
+
 	message := ""
 
 	switch v := obj.(type) {
@@ -562,11 +768,11 @@ func (nr *NewRelicLogger) exists(level logrus.Level, obj interface{}, args ...in
 		message = fmt.Sprintf(message, args...)
 	}
 
-	if utils.IsEmpty(message) && !nr.log.IsLevelEnabled(level) {
+	if utils.IsEmpty(message) {
 		return false, nil, ""
 	}
 
-	function, file, line := utils.CallerGetInfo(nr.callerOffset + 5)
+	function, file, line := utils.CallerGetInfo(nr.callerOffset + 6)
 	fields := logrus.Fields{
 		"file":    fmt.Sprintf("%s:%d", file, line),
 		"func":    function,
@@ -588,8 +794,38 @@ func (nr *NewRelicLogger) Stop() {
 		nr.connection.Close()
 	}
 	if nr.harvester != nil {
-		nr.harvester.HarvestNow(context.Background())
+		nr.harvester.Stop(context.Background())
+	}
+}
+
+func (nr *NewRelicLogger) Flush(ctx context.Context) error {
+
+	var err error
+	if nr.connection != nil {
+		err = nr.connection.Flush(ctx)
+	}
+	if nr.harvester != nil {
+		err = errors.Join(err, nr.harvester.Harvest(ctx))
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (nr *NewRelicLogger) Shutdown(ctx context.Context) error {
+
+	var err error
+	if nr.connection != nil {
+		err = waitContext(ctx, nr.connection.Close)
+	}
+	if nr.harvester != nil {
+		err = errors.Join(err, nr.harvester.Stop(ctx))
+	}
+	if err != nil {
+		return err
 	}
+	return ctx.Err()
 }
 
 func NewNewRelicLogger(options NewRelicLoggerOptions, logger common.Logger, stdout *Stdout) *NewRelicLogger {
@@ -603,23 +839,21 @@ func NewNewRelicLogger(options NewRelicLoggerOptions, logger common.Logger, stdo
 		return nil
 	}
 
-	var connection *net.TCPConn = nil
+	level := logLevel(options.Level)
+
+	var connection *AgentWriter = nil
 	var log *logrus.Logger = nil
 
 	if utils.IsEmpty(options.Endpoint) && !utils.IsEmpty(options.AgentHost) {
 
-		address := fmt.Sprintf("%s:%d", options.AgentHost, options.AgentPort)
-		serverAddr, err := net.ResolveTCPAddr("tcp", address)
-		if err != nil {
-			stdout.Error(err)
-			return nil
-		}
-
-		connection, err = net.DialTCP("tcp", nil, serverAddr)
-		if err != nil {
-			stdout.Error(err)
-			return nil
-		}
+		connection = NewAgentWriter(AgentWriterOptions{
+			Network:    "tcp",
+			Host:       options.AgentHost,
+			Port:       options.AgentPort,
+			BufferSize: options.BufferSize,
+			Provider:   "newrelic",
+			Signal:     common.TelemetryLogs,
+		})
 
 		formatter := &logrus.JSONFormatter{
 			FieldMap: logrus.FieldMap{
@@ -630,30 +864,13 @@ func NewNewRelicLogger(options NewRelicLoggerOptions, logger common.Logger, stdo
 		}
 		formatter.TimestampFormat = time.RFC3339Nano
 
-		log := logrus.New()
+		log = logrus.New()
 		log.SetFormatter(formatter)
-
-		switch options.Level {
-		case "info":
-			log.SetLevel(logrus.InfoLevel)
-		case "error":
-			log.SetLevel(logrus.ErrorLevel)
-		case "panic":
-			log.SetLevel(logrus.PanicLevel)
-		case "warn":
-			log.SetLevel(logrus.WarnLevel)
-		case "debug":
-			log.SetLevel(logrus.DebugLevel)
-		default:
-			log.SetLevel(logrus.InfoLevel)
-		}
-
-		if connection != nil {
-			log.SetOutput(connection)
-		}
+		log.SetLevel(level)
+		log.SetOutput(connection)
 	}
 
-	var harvester *telemetry.Harvester = nil
+	var harvester *NewRelicHarvester = nil
 
 	if !utils.IsEmpty(options.Endpoint) {
 
@@ -677,7 +894,7 @@ func NewNewRelicLogger(options NewRelicLoggerOptions, logger common.Logger, stdo
 			)
 		}
 
-		h, err := telemetry.NewHarvester(cfgs...)
+		h, err := newRelicHarvester(common.TelemetryLogs, cfgs...)
 		if err != nil {
 			stdout.Error(err)
 			return nil
@@ -692,132 +909,248 @@ func NewNewRelicLogger(options NewRelicLoggerOptions, logger common.Logger, stdo
 		connection:   connection,
 		stdout:       stdout,
 		log:          log,
+		level:        level,
 		options:      options,
 		callerOffset: 1,
 	}
 }
 
-func (nrc *NewRelicCounter) getGlobalTags(labelValues ...string) map[string]interface{} {
+func (nrm *NewRelicMeter) build(name string, labels common.Labels, prefixes ...string) (string, map[string]interface{}, error) {
 
-	m := make(map[string]interface{})
-	l := len(labelValues)
+	var names []string
 
-	for index, name := range nrc.labels {
-		if l > index {
-			m[name] = labelValues[index]
-		}
+	names = append(names, nrm.options.Prefix)
+	names = append(names, prefixes...)
+	names = append(names, name)
+
+	newName, err := common.NewRelicMetricNaming.Name(names...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	labels, err = common.NewRelicMetricNaming.Labels(labels)
+	if err != nil {
+		return "", nil, err
 	}
-	return m
+
+	m := make(map[string]interface{})
+	for k, v := range labels {
+		m[k] = v
+	}
+	return newName, m, nil
 }
 
 func (nrc *NewRelicCounter) Inc() common.Counter {
 
-	/*attributes := nrc.getGlobalTags(labelValues...)
-	_, file, line := utils.CallerGetInfo(nrc.meter.callerOffset + 3)
-	attributes["file"] = fmt.Sprintf("%s:%d", file, line)
+	nrc.count.Increment()
+	nrc.meter.harvester.touch(nrc)
+	return nrc
+}
 
-	nrc.meter.harvester.RecordMetric(telemetry.Count{
-		Timestamp:  time.Now(),
-		Name:       nrc.name,
-		Value:      1,
-		Attributes: attributes,
-	})
+func (nrc *NewRelicCounter) Add(value int) common.Counter {
 
-	return nrc*/
-	return nil
+	nrc.count.Increase(float64(value))
+	nrc.meter.harvester.touch(nrc)
+	return nrc
 }
 
-func (nrm *NewRelicMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
+// AddWithSpan adds value only, as aggregated metrics have no exemplars
+func (nrc *NewRelicCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
 
-	/*var names []string
-
-	if !utils.IsEmpty(nrm.options.Prefix) {
-		names = append(names, nrm.options.Prefix)
-	}
+	return nrc.Add(value)
+}
 
-	names = append(names, prefixes...)
-	names = append(names, name)
-	newName := strings.Join(names, ".")
+func (nrm *NewRelicMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
 
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return nil
+	}
 	return &NewRelicCounter{
 		meter:       nrm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		count:       nrm.harvester.MetricAggregator().Count(newName, attributes),
+	}
 }
 
-func (nrm *NewRelicMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+func (nrfc *NewRelicFloatCounter) Add(value float64) common.FloatCounter {
+
+	nrfc.count.Increase(value)
+	nrfc.meter.harvester.touch(nrfc)
+	return nrfc
+}
 
-	/*var names []string
+func (nrm *NewRelicMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
 
-	if !utils.IsEmpty(nrm.options.Prefix) {
-		names = append(names, nrm.options.Prefix)
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return nil
 	}
+	return &NewRelicFloatCounter{
+		meter:       nrm,
+		name:        newName,
+		description: description,
+		count:       nrm.harvester.MetricAggregator().Count(newName, attributes),
+	}
+}
 
-	names = append(names, prefixes...)
-	names = append(names, name)
-	newName := strings.Join(names, ".")
+func (nrh *NewRelicHistogram) Observe(value float64) common.Histogram {
+
+	nrh.summary.Record(value)
+	nrh.meter.harvester.touch(nrh)
+	return nrh
+}
+
+// ObserveWithSpan observes value only, as aggregated metrics have no exemplars
+func (nrh *NewRelicHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
 
+	return nrh.Observe(value)
+}
+
+// Histogram is sent as summary metric (count, sum, min, max) as NewRelic has no buckets
+func (nrm *NewRelicMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return nil
+	}
 	return &NewRelicHistogram{
 		meter:       nrm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		summary:     nrm.harvester.MetricAggregator().Summary(newName, attributes),
+	}
 }
 
-func (nrg *NewRelicGauge) getGlobalTags(labelValues ...string) map[string]interface{} {
+func (nrg *NewRelicGauge) Set(value float64) common.Gauge {
 
-	m := make(map[string]interface{})
-	l := len(labelValues)
+	nrg.gauge.Value(nrg.value.Set(value))
+	nrg.meter.harvester.touch(nrg)
+	return nrg
+}
 
-	for index, name := range nrg.labels {
-		if l > index {
-			m[name] = labelValues[index]
-		}
-	}
-	return m
+func (nrg *NewRelicGauge) Add(value float64) common.Gauge {
+
+	nrg.gauge.Value(nrg.value.Add(value))
+	nrg.meter.harvester.touch(nrg)
+	return nrg
 }
 
-func (nrg *NewRelicGauge) Set(value float64) common.Gauge {
+func (nrg *NewRelicGauge) Sub(value float64) common.Gauge {
 
-	/*attributes := nrg.getGlobalTags(labelValues...)
-	_, file, line := utils.CallerGetInfo(nrg.meter.callerOffset + 3)
-	attributes["file"] = fmt.Sprintf("%s:%d", file, line)
+	nrg.gauge.Value(nrg.value.Add(-value))
+	nrg.meter.harvester.touch(nrg)
+	return nrg
+}
 
-	nrg.meter.harvester.RecordMetric(telemetry.Gauge{
-		Timestamp:  time.Now(),
-		Name:       nrg.name,
-		Value:      value,
-		Attributes: attributes,
-	})
+func (nrg *NewRelicGauge) Inc() common.Gauge {
 
-	return nrg*/
-	return nil
+	return nrg.Add(1)
+}
+
+func (nrg *NewRelicGauge) Dec() common.Gauge {
+
+	return nrg.Sub(1)
+}
+
+func newRelicGaugeKey(name string, labels common.Labels) string {
+
+	var arr []string
+	for k, v := range labels {
+		arr = append(arr, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(arr)
+	return fmt.Sprintf("%s%v", name, arr)
 }
 
 func (nrm *NewRelicMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
 
-	/*var names []string
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return nil
+	}
 
-	if !utils.IsEmpty(nrm.options.Prefix) {
-		names = append(names, nrm.options.Prefix)
+	// gauge keeps its value, so the same name and labels share it
+	key := newRelicGaugeKey(newName, labels)
+	if _, ok := nrm.observables.Load(key); ok {
+		nrm.logger.Error(fmt.Errorf("newrelic gauge %s is observable, it can't be set", key))
+		return nil
 	}
 
-	names = append(names, prefixes...)
-	names = append(names, name)
-	newName := strings.Join(names, ".")
+	g, ok := nrm.gauges.Load(key)
+	if ok {
+		return g.(*NewRelicGauge)
+	}
 
-	return &NewRelicGauge{
+	g, _ = nrm.gauges.LoadOrStore(key, &NewRelicGauge{
 		meter:       nrm,
 		name:        newName,
 		description: description,
-		labels:      labels,
-	}*/
-	return nil
+		gauge:       nrm.harvester.MetricAggregator().Gauge(newName, attributes),
+	})
+	return g.(*NewRelicGauge)
+}
+
+// ObservableGauge keeps callback of the first registration, series of gauge which is set can't be observed
+func (nrm *NewRelicMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return
+	}
+
+	key := newRelicGaugeKey(newName, labels)
+	if _, ok := nrm.gauges.Load(key); ok {
+		nrm.logger.Error(fmt.Errorf("newrelic gauge %s is set, it can't be observable", key))
+		return
+	}
+	if _, loaded := nrm.observables.LoadOrStore(key, true); loaded {
+		return
+	}
+
+	gauge := &NewRelicGauge{
+		meter:       nrm,
+		name:        newName,
+		description: description,
+		gauge:       nrm.harvester.MetricAggregator().Gauge(newName, attributes),
+	}
+	nrm.observer.Observe(func() {
+		gauge.Set(callback())
+	})
+}
+
+func (nrm *NewRelicMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	return nrm.Histogram(group, name, description, labels, prefixes...)
+}
+
+func (nrs *NewRelicSummary) Observe(value float64) common.Summary {
+
+	nrs.summary.Record(value)
+	nrs.meter.harvester.touch(nrs)
+	return nrs
+}
+
+// Summary is aggregated per harvest period, quantiles and window are ignored, NewRelic calculates them on its side
+func (nrm *NewRelicMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	newName, attributes, err := nrm.build(name, labels, prefixes...)
+	if err != nil {
+		nrm.logger.Error(err)
+		return nil
+	}
+	return &NewRelicSummary{
+		meter:       nrm,
+		name:        newName,
+		description: description,
+		summary:     nrm.harvester.MetricAggregator().Summary(newName, attributes),
+	}
 }
 
 func (nrm *NewRelicMeter) Group(name string) common.Group {
@@ -830,9 +1163,31 @@ func (nrm *NewRelicMeter) SetCallerOffset(offset int) {
 }
 
 func (nrm *NewRelicMeter) Stop() {
+	nrm.observer.Stop()
+	if nrm.harvester != nil {
+		nrm.harvester.Stop(context.Background())
+	}
+}
+
+func (nrm *NewRelicMeter) Flush(ctx context.Context) error {
+
+	if nrm.harvester != nil {
+		if err := nrm.harvester.Harvest(ctx); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (nrm *NewRelicMeter) Shutdown(ctx context.Context) error {
+
+	nrm.observer.Stop()
 	if nrm.harvester != nil {
-		nrm.harvester.HarvestNow(context.Background())
+		if err := nrm.harvester.Stop(ctx); err != nil {
+			return err
+		}
 	}
+	return ctx.Err()
 }
 
 func NewNewRelicMeter(options NewRelicMeterOptions, logger common.Logger, stdout *Stdout) *NewRelicMeter {
@@ -866,7 +1221,7 @@ func NewNewRelicMeter(options NewRelicMeterOptions, logger common.Logger, stdout
 		)
 	}
 
-	harvester, err := telemetry.NewHarvester(cfgs...)
+	harvester, err := newRelicHarvester(common.TelemetryMetrics, cfgs...)
 	if err != nil {
 		stdout.Error(err)
 		return nil
@@ -879,6 +1234,9 @@ func NewNewRelicMeter(options NewRelicMeterOptions, logger common.Logger, stdout
 		options:      options,
 		logger:       logger,
 		callerOffset: 1,
+		gauges:       &sync.Map{},
+		observables:  &sync.Map{},
+		observer:     NewMeterObserver(MeterObserverDefaultInterval),
 	}
 }
 
@@ -918,8 +1276,28 @@ func (nre *NewRelicEventer) At(name string, message string, attributes map[strin
 
 func (nre *NewRelicEventer) Stop() {
 	if nre.harvester != nil {
-		nre.harvester.HarvestNow(context.Background())
+		nre.harvester.Stop(context.Background())
+	}
+}
+
+func (nre *NewRelicEventer) Flush(ctx context.Context) error {
+
+	if nre.harvester != nil {
+		if err := nre.harvester.Harvest(ctx); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (nre *NewRelicEventer) Shutdown(ctx context.Context) error {
+
+	if nre.harvester != nil {
+		if err := nre.harvester.Stop(ctx); err != nil {
+			return err
+		}
 	}
+	return ctx.Err()
 }
 
 func NewNewRelicEventer(options NewRelicEventerOptions, logger common.Logger, stdout *Stdout) *NewRelicEventer {
@@ -953,7 +1331,7 @@ func NewNewRelicEventer(options NewRelicEventerOptions, logger common.Logger, st
 		)
 	}
 
-	harvester, err := telemetry.NewHarvester(cfgs...)
+	harvester, err := newRelicHarvester(common.TelemetryEvents, cfgs...)
 	if err != nil {
 		stdout.Error(err)
 		return nil
@@ -1,9 +1,17 @@
 package provider
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
 	"errors"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -40,10 +48,8 @@ func newrelicNewMeter(endpoint string) (*NewRelicMeter, *Stdout) {
 func newrelicNewLogger(agentHost, level string) (*NewRelicLogger, *Stdout, net.Listener) {
 
 	agentPort := 51710
-	listener, err := net.Listen("tcp", agentHost+":"+strconv.Itoa(agentPort))
-	if err != nil {
-		return nil, nil, nil
-	}
+	// agent host might be unavailable, logger should connect later
+	listener, _ := net.Listen("tcp", agentHost+":"+strconv.Itoa(agentPort))
 
 	stdout := NewStdout(StdoutOptions{
 		Format:          "template",
@@ -96,6 +102,23 @@ func TestNewRelicMeter(t *testing.T) {
 		counter.Inc()
 	}
 
+	summary := newrelic.Summary("", metricName, "description", labels, []float64{0.5, 0.99}, time.Minute, "summary")
+	if summary == nil {
+		t.Fatal("Invalid newrelic summary")
+	}
+	summary.Observe(1).Observe(2)
+
+	// observable gauge can't be set, gauge which is set can't get callback
+	newrelic.ObservableGauge("", "observed", "description", nil, func() float64 { return 42 })
+	if newrelic.Gauge("", "observed", "description", nil) != nil {
+		t.Fatal("Observable gauge is returned as gauge")
+	}
+	newrelic.Gauge("", "inflight", "description", nil).Set(1)
+	newrelic.ObservableGauge("", "inflight", "description", nil, func() float64 { return 42 })
+	if newrelic.Gauge("", "inflight", "description", nil) == nil {
+		t.Fatal("Gauge is observable")
+	}
+
 	newrelic.Stop()
 }
 
@@ -214,8 +237,313 @@ func TestNewRelicLoggerEmptyAgentHost(t *testing.T) {
 
 func TestNewRelicLoggerWrongAgentHost(t *testing.T) {
 
+	// agent might be unavailable on startup, logger connects later
 	NewRelic, _, _ := newrelicNewLogger("ewqdWDEW1111ss", "how")
-	if NewRelic != nil {
-		t.Fatal("Valid NewRelic")
+	if NewRelic == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+	defer NewRelic.Stop()
+	NewRelic.Info("info")
+}
+
+func newrelicNewAgent(t *testing.T, drop int) (net.Listener, chan string) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 100)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// emulate agent restart by dropping first connections
+			if i < drop {
+				conn.Close()
+				continue
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}(conn)
+		}
+	}()
+	return listener, lines
+}
+
+func newrelicReadLines(lines chan string, timeout time.Duration) []string {
+
+	var r []string
+	for {
+		select {
+		case line := <-lines:
+			r = append(r, line)
+		case <-time.After(timeout):
+			return r
+		}
+	}
+}
+
+func TestNewRelicLoggerAgentLevel(t *testing.T) {
+
+	listener, lines := newrelicNewAgent(t, 0)
+	defer listener.Close()
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	addr := listener.Addr().(*net.TCPAddr)
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	NewRelic := NewNewRelicLogger(NewRelicLoggerOptions{
+		AgentHost: addr.IP.String(),
+		AgentPort: addr.Port,
+		Level:     "warn",
+		NewRelicOptions: NewRelicOptions{
+			ServiceName: "sre-newrelic-logger-test",
+		},
+	}, nil, stdout)
+	if NewRelic == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+	defer NewRelic.Stop()
+
+	NewRelic.Info("skipped")
+	NewRelic.Debug("skipped")
+	NewRelic.Warn("passed %d", 1)
+	NewRelic.SpanError(nil, errors.New("passed 2"))
+
+	r := newrelicReadLines(lines, time.Second)
+	if len(r) != 2 {
+		t.Fatalf("Invalid number of lines %d, expected 2", len(r))
+	}
+	for _, line := range r {
+		if !strings.Contains(line, "passed") {
+			t.Fatalf("Invalid line %s", line)
+		}
+	}
+
+	labels := common.Labels{"provider": "newrelic", "signal": common.TelemetryLogs}
+	if v := meter.CounterValue("telemetry_records_sent", labels); v != 2 {
+		t.Fatalf("Invalid sent records %v, expected 2", v)
+	}
+}
+
+func TestNewRelicLoggerAgentReconnect(t *testing.T) {
+
+	listener, lines := newrelicNewAgent(t, 1)
+	defer listener.Close()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	NewRelic := NewNewRelicLogger(NewRelicLoggerOptions{
+		AgentHost: addr.IP.String(),
+		AgentPort: addr.Port,
+		Level:     "info",
+	}, nil, stdout)
+	if NewRelic == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+	defer NewRelic.Stop()
+
+	var r []string
+	for i := 0; i < 20 && len(r) == 0; i++ {
+		NewRelic.Info("message %d", i)
+		r = newrelicReadLines(lines, 100*time.Millisecond)
+	}
+	if len(r) == 0 {
+		t.Fatal("No lines after reconnect")
+	}
+}
+
+func TestNewRelicLoggerApiLevel(t *testing.T) {
+
+	var mutex sync.Mutex
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		reader, err := gzip.NewReader(r.Body)
+		if err == nil {
+			b, _ := ioutil.ReadAll(reader)
+			mutex.Lock()
+			bodies = append(bodies, string(b))
+			mutex.Unlock()
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	NewRelic := NewNewRelicLogger(NewRelicLoggerOptions{
+		Endpoint: server.URL,
+		Level:    "info",
+		NewRelicOptions: NewRelicOptions{
+			ApiKey:      "sdfsFFDfd",
+			ServiceName: "sre-newrelic-logger-test",
+		},
+	}, nil, stdout)
+	if NewRelic == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+
+	NewRelic.Debug("skipped")
+	NewRelic.Info("passed")
+	NewRelic.SpanWarn(nil, "passed")
+	NewRelic.Stop()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	content := strings.Join(bodies, "\n")
+	if !strings.Contains(content, "passed") {
+		t.Fatalf("No messages sent: %s", content)
+	}
+	if strings.Contains(content, "skipped") {
+		t.Fatalf("Message is sent regardless level: %s", content)
+	}
+}
+
+func TestNewRelicLoggerApiTelemetry(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	NewRelic := NewNewRelicLogger(NewRelicLoggerOptions{
+		Endpoint: server.URL,
+		Level:    "info",
+		NewRelicOptions: NewRelicOptions{
+			ApiKey: "sdfsFFDfd",
+		},
+	}, nil, stdout)
+	if NewRelic == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+
+	for i := 0; i < 3; i++ {
+		NewRelic.Info("message %d", i)
+	}
+	NewRelic.Stop()
+
+	labels := common.Labels{"provider": "newrelic", "signal": common.TelemetryLogs}
+	if v := meter.CounterValue("telemetry_records_queued", labels); v != 3 {
+		t.Fatalf("Invalid queued records %v, expected 3", v)
+	}
+	if v := meter.CounterValue("telemetry_records_sent", labels); v != 3 {
+		t.Fatalf("Invalid sent records %v, expected 3", v)
+	}
+}
+
+func TestNewRelicMeterTelemetry(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	meter := NewMemoryMeter(nil)
+	common.SetTelemetry(common.NewTelemetry(meter))
+	defer common.SetTelemetry(nil)
+
+	newrelic, _ := newrelicNewMeter(server.URL)
+	if newrelic == nil {
+		t.Fatal("Invalid newrelic")
+	}
+
+	// aggregated metric is counted once per harvest
+	counter := newrelic.Counter("", "calls", "", common.Labels{})
+	counter.Inc()
+	counter.Add(2)
+	newrelic.Gauge("", "size", "", common.Labels{}).Set(1)
+
+	if err := newrelic.Flush(context.Background()); err == nil {
+		t.Fatal("Flush doesn't return harvest error")
+	}
+	newrelic.Stop()
+
+	labels := common.Labels{"provider": "newrelic", "signal": common.TelemetryMetrics}
+	if v := meter.CounterValue("telemetry_records_failed", labels); v != 2 {
+		t.Fatalf("Invalid failed records %v, expected 2", v)
+	}
+	if v := meter.CounterValue("telemetry_records_sent", labels); v != 0 {
+		t.Fatalf("Invalid sent records %v, expected 0", v)
+	}
+}
+
+func TestNewRelicTracerTailSampler(t *testing.T) {
+
+	var mutex sync.Mutex
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		reader, err := gzip.NewReader(r.Body)
+		if err == nil {
+			b, _ := ioutil.ReadAll(reader)
+			mutex.Lock()
+			bodies = append(bodies, string(b))
+			mutex.Unlock()
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	tracer := NewNewRelicTracer(NewRelicTracerOptions{
+		Endpoint: server.URL,
+		NewRelicOptions: NewRelicOptions{
+			ApiKey:      "sdfsFFDfd",
+			ServiceName: "sre-newrelic-tracer-test",
+		},
+	}, nil, stdout)
+	if tracer == nil {
+		t.Fatal("Invalid NewRelic")
+	}
+
+	tail, err := common.NewTailSampler(common.TailSamplerOptions{Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traces := common.NewTraces()
+	traces.SetTailSampler(tail)
+	traces.Register(tracer)
+
+	failed := traces.StartSpan().SetName("failed-root")
+	traces.StartChildSpan(failed.GetContext()).SetName("failed-child").Finish()
+	failed.Error(errors.New("failed")).Finish()
+	traces.StartSpan().SetName("passed-root").Finish()
+
+	if err := traces.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	content := strings.Join(bodies, "\n")
+	if !strings.Contains(content, "failed-root") || !strings.Contains(content, "failed-child") {
+		t.Fatalf("Failed trace is not sent: %s", content)
+	}
+	if strings.Contains(content, "passed-root") {
+		t.Fatalf("Passed trace is sent: %s", content)
 	}
 }
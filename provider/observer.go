@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+const MeterObserverDefaultInterval = time.Second * 10
+
+// MeterGaugeValue keeps gauge value for providers which accept only absolute values
+type MeterGaugeValue struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// MeterObserver calls registered callbacks periodically for providers without pull model
+type MeterObserver struct {
+	interval  time.Duration
+	callbacks []func()
+	mutex     sync.Mutex
+	stop      chan struct{}
+	once      sync.Once
+	started   bool
+	wg        sync.WaitGroup
+}
+
+func (gv *MeterGaugeValue) Set(value float64) float64 {
+
+	gv.mutex.Lock()
+	defer gv.mutex.Unlock()
+
+	gv.value = value
+	return gv.value
+}
+
+func (gv *MeterGaugeValue) Add(value float64) float64 {
+
+	gv.mutex.Lock()
+	defer gv.mutex.Unlock()
+
+	gv.value = gv.value + value
+	return gv.value
+}
+
+func (mo *MeterObserver) run() {
+
+	defer mo.wg.Done()
+
+	ticker := time.NewTicker(mo.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mo.stop:
+			return
+		case <-ticker.C:
+		}
+
+		mo.mutex.Lock()
+		callbacks := append([]func(){}, mo.callbacks...)
+		mo.mutex.Unlock()
+
+		for _, c := range callbacks {
+			c()
+		}
+	}
+}
+
+// Observe registers callback and starts observing on first call
+func (mo *MeterObserver) Observe(callback func()) {
+
+	mo.mutex.Lock()
+	defer mo.mutex.Unlock()
+
+	mo.callbacks = append(mo.callbacks, callback)
+	if !mo.started {
+		mo.started = true
+		mo.wg.Add(1)
+		go mo.run()
+	}
+}
+
+func (mo *MeterObserver) Stop() {
+
+	mo.once.Do(func() {
+		close(mo.stop)
+	})
+	mo.wg.Wait()
+}
+
+func NewMeterObserver(interval time.Duration) *MeterObserver {
+
+	if interval <= 0 {
+		interval = MeterObserverDefaultInterval
+	}
+
+	return &MeterObserver{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
@@ -1,13 +1,23 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/devopsext/sre/common"
@@ -15,21 +25,43 @@ import (
 )
 
 type PrometheusOptions struct {
-	URL       string
-	Listen    string
-	Version   string
-	Prefix    string
-	GoRuntime bool
+	URL          string
+	Listen       string
+	Version      string
+	Prefix       string
+	GoRuntime    bool
+	PushURL      string
+	PushJob      string
+	PushInstance string
+	PushInterval time.Duration
+	PushMethod   string
+	PushUsername string
+	PushPassword string
+	ServiceName  string
+	Environment  string
+
+	RemoteWriteURL       string
+	RemoteWriteInterval  time.Duration
+	RemoteWriteQueueSize int
+	RemoteWriteRetries   int
+	RemoteWriteUsername  string
+	RemoteWritePassword  string
 }
 
 type PrometheusCounter struct {
 	meter   *PrometheusMeter
+	set     *metrics.Set
+	ident   string
 	counter *metrics.Counter
 }
 
+type PrometheusFloatCounter struct {
+	meter   *PrometheusMeter
+	counter *metrics.FloatCounter
+}
+
 type PrometheusGauge struct {
 	meter *PrometheusMeter
-	value float64
 	gauge *metrics.Gauge
 }
 
@@ -39,33 +71,112 @@ type PrometheusGroup struct {
 	set   *metrics.Set
 }
 
+// prometheusObservable is key of gauge created with callback, it can't be set
+type prometheusObservable struct {
+	set   *metrics.Set
+	ident string
+}
+
 type PrometheusHistogram struct {
 	meter     *PrometheusMeter
-	histogram *metrics.Histogram
+	set       *metrics.Set
+	ident     string
+	bounds    []float64
+	histogram interface{ Update(value float64) }
+}
+
+type prometheusExemplar struct {
+	set       *metrics.Set
+	traceID   string
+	spanID    string
+	value     float64
+	timestamp time.Time
+}
+
+type PrometheusSummary struct {
+	meter   *PrometheusMeter
+	summary *metrics.Summary
 }
 
 type PrometheusMeter struct {
-	options  PrometheusOptions
-	logger   common.Logger
-	listener *net.Listener
-	groups   *sync.Map
+	options      PrometheusOptions
+	logger       common.Logger
+	listener     *net.Listener
+	groups       *sync.Map
+	descriptions *sync.Map
+	exemplars    *sync.Map
+	created      *sync.Map
+	observables  *sync.Map
+	pushStop     chan struct{}
+	pushOnce     sync.Once
+	pushWG       sync.WaitGroup
+	remoteWriter *PrometheusRemoteWriter
+}
+
+type prometheusWriteOptions struct {
+	processMetrics bool
+	openMetrics    bool
+	names          map[string]bool
 }
 
+const (
+	PrometheusContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	PrometheusContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+const prometheusSummaryWindow = time.Minute * 5
+
+const prometheusPushTimeout = time.Second * 10
+
+var prometheusSummaryQuantiles = []float64{0.5, 0.9, 0.97, 0.99, 1}
+
+var prometheusHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// units are detected by suffix of family name, as OpenMetrics requires
+var prometheusUnits = []string{"seconds", "bytes", "ratio", "meters", "grams", "celsius", "volts", "amperes", "joules"}
+
+var prometheusSuffixes = []string{"_total", "_bucket", "_sum", "_count", "_created"}
+
+var prometheusOpenMetricsHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// Clear unregisters metrics of group and forgets their exemplars, creation times and callbacks
 func (p *PrometheusGroup) Clear() {
+
+	for _, name := range p.set.ListMetricNames() {
+		p.meter.created.Delete(name)
+	}
 	p.set.UnregisterAllMetrics()
+
+	p.meter.exemplars.Range(func(key, value interface{}) bool {
+		if value.(*prometheusExemplar).set == p.set {
+			p.meter.exemplars.Delete(key)
+		}
+		return true
+	})
+	p.meter.observables.Range(func(key, value interface{}) bool {
+		if key.(prometheusObservable).set == p.set {
+			p.meter.observables.Delete(key)
+		}
+		return true
+	})
 }
 
-func (p *PrometheusMeter) buildIdent(name string, labels common.Labels, prefixes ...string) string {
+func (p *PrometheusMeter) buildName(name string, prefixes ...string) (string, error) {
 
 	var names []string
 
-	if !utils.IsEmpty(p.options.Prefix) {
-		names = append(names, p.options.Prefix)
-	}
-
+	names = append(names, p.options.Prefix)
 	names = append(names, prefixes...)
 	names = append(names, name)
-	name = strings.Join(names, "_")
+	return common.PrometheusMetricNaming.Name(names...)
+}
+
+func (p *PrometheusMeter) buildIdent(name string, labels common.Labels) (string, error) {
+
+	labels, err := common.PrometheusMetricNaming.Labels(labels)
+	if err != nil {
+		return "", err
+	}
 
 	lbs := ""
 	if len(labels) > 0 {
@@ -76,7 +187,250 @@ func (p *PrometheusMeter) buildIdent(name string, labels common.Labels, prefixes
 		sort.Strings(arr)
 		lbs = fmt.Sprintf("{%s}", strings.Join(arr, ","))
 	}
-	return fmt.Sprintf(`%s%s`, name, lbs)
+	return fmt.Sprintf(`%s%s`, name, lbs), nil
+}
+
+// create builds ident and creates metric in group set, panics of VictoriaMetrics are returned as errors
+func (p *PrometheusMeter) create(group, name, description string, labels common.Labels, prefixes []string, f func(set *metrics.Set, ident string) interface{}) (m interface{}, err error) {
+
+	family, err := p.buildName(name, prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := p.buildIdent(family, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	set := metrics.GetDefaultSet()
+	gr := p.findGroup(group)
+	if gr != nil {
+		set = gr.set
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			m = nil
+			err = fmt.Errorf("prometheus metric %s: %v", ident, r)
+		}
+	}()
+
+	m = f(set, ident)
+	p.describe(family, description)
+	p.created.LoadOrStore(ident, time.Now())
+	return m, nil
+}
+
+// describe keeps description of metric family for HELP line
+func (p *PrometheusMeter) describe(family, description string) {
+
+	if utils.IsEmpty(description) {
+		return
+	}
+	p.descriptions.Store(family, description)
+}
+
+func (e *prometheusExemplar) String() string {
+
+	labels := fmt.Sprintf(`trace_id="%s"`, common.PrometheusMetricNaming.Value(e.traceID))
+	if !utils.IsEmpty(e.spanID) {
+		labels = fmt.Sprintf(`%s,span_id="%s"`, labels, common.PrometheusMetricNaming.Value(e.spanID))
+	}
+	return fmt.Sprintf("# {%s} %g %.3f", labels, e.value, float64(e.timestamp.UnixNano())/1e9)
+}
+
+// exemplar keeps the latest exemplar of series line, if span has trace ID
+func (p *PrometheusMeter) exemplar(set *metrics.Set, series string, value float64, span common.TracerSpanContext) {
+
+	if span == nil || utils.IsEmpty(span.GetTraceID()) {
+		return
+	}
+
+	p.exemplars.Store(series, &prometheusExemplar{
+		set:       set,
+		traceID:   span.GetTraceID(),
+		spanID:    span.GetSpanID(),
+		value:     value,
+		timestamp: time.Now(),
+	})
+}
+
+func prometheusSplitSeries(series string) (string, string) {
+
+	n := strings.IndexByte(series, '{')
+	if n < 0 {
+		return series, ""
+	}
+	return series[:n], series[n:]
+}
+
+func prometheusUnit(family string) string {
+
+	for _, u := range prometheusUnits {
+		if strings.HasSuffix(family, "_"+u) {
+			return u
+		}
+	}
+	return ""
+}
+
+// match checks metric name or its family against name[] filter
+func (o *prometheusWriteOptions) match(name string) bool {
+
+	if len(o.names) == 0 || o.names[name] {
+		return true
+	}
+	for _, s := range prometheusSuffixes {
+		if strings.HasSuffix(name, s) && o.names[strings.TrimSuffix(name, s)] {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMetrics writes all metrics with HELP lines completed by descriptions,
+// in OpenMetrics format counters get _total suffix, exemplars, _created series and units are added
+// and vmrange histograms become untyped
+func (p *PrometheusMeter) writeMetrics(w io.Writer, options prometheusWriteOptions) {
+
+	var bb bytes.Buffer
+	metrics.WritePrometheus(&bb, options.processMetrics)
+
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(bb.String(), "\n"), "\n")
+	help := ""
+	kind := ""
+	family := ""
+
+	for i, line := range lines {
+
+		if utils.IsEmpty(line) {
+			continue
+		}
+
+		if strings.HasPrefix(line, "# HELP ") {
+			// written together with TYPE line, as family might be renamed
+			help = strings.TrimSpace(strings.TrimPrefix(line, "# HELP "))
+			continue
+		}
+
+		if strings.HasPrefix(line, "# TYPE ") {
+
+			fields := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(fields) < 2 {
+				continue
+			}
+			family = fields[0]
+			kind = fields[1]
+
+			if !options.match(family) {
+				help = ""
+				continue
+			}
+
+			if options.openMetrics {
+				if kind == "histogram" && i+1 < len(lines) && strings.Contains(lines[i+1], "vmrange=") {
+					kind = "unknown"
+					help = ""
+					continue
+				}
+				if kind == "counter" {
+					family = strings.TrimSuffix(family, "_total")
+				}
+			}
+
+			description := ""
+			d, ok := p.descriptions.Load(help)
+			if ok {
+				description = d.(string)
+			}
+
+			if options.openMetrics {
+				if !utils.IsEmpty(description) {
+					writer.WriteString(fmt.Sprintf("# HELP %s %s\n", family, prometheusOpenMetricsHelpEscaper.Replace(description)))
+				}
+			} else if !utils.IsEmpty(help) {
+				if !utils.IsEmpty(description) {
+					writer.WriteString(fmt.Sprintf("# HELP %s %s\n", help, prometheusHelpEscaper.Replace(description)))
+				} else {
+					writer.WriteString(fmt.Sprintf("# HELP %s\n", help))
+				}
+			}
+			help = ""
+
+			writer.WriteString(fmt.Sprintf("# TYPE %s %s\n", family, kind))
+
+			unit := prometheusUnit(family)
+			if options.openMetrics && !utils.IsEmpty(unit) {
+				writer.WriteString(fmt.Sprintf("# UNIT %s %s\n", family, unit))
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if !options.openMetrics {
+				writer.WriteString(line)
+				writer.WriteByte('\n')
+			}
+			continue
+		}
+
+		// value is after the last space, as label values might have spaces
+		n := strings.LastIndexByte(line, ' ')
+		if n < 0 {
+			continue
+		}
+		series := line[:n]
+		name, labels := prometheusSplitSeries(series)
+
+		if !options.match(name) {
+			continue
+		}
+
+		if !options.openMetrics {
+			writer.WriteString(line)
+			writer.WriteByte('\n')
+			continue
+		}
+
+		// ident of series which has _created series
+		ident := ""
+
+		switch kind {
+		case "counter":
+			if !strings.HasSuffix(name, "_total") {
+				line = fmt.Sprintf("%s_total%s%s", name, labels, line[n:])
+			}
+			ident = series
+		case "histogram", "summary":
+			if strings.HasSuffix(name, "_count") {
+				ident = strings.TrimSuffix(name, "_count") + labels
+			}
+		}
+
+		e, ok := p.exemplars.Load(series)
+		if ok && (kind == "counter" || kind == "histogram") {
+			line = fmt.Sprintf("%s %s", line, e.(*prometheusExemplar).String())
+		}
+
+		writer.WriteString(line)
+		writer.WriteByte('\n')
+
+		if utils.IsEmpty(ident) {
+			continue
+		}
+		c, ok := p.created.Load(ident)
+		if ok {
+			writer.WriteString(fmt.Sprintf("%s_created%s %.3f\n", family, labels, float64(c.(time.Time).UnixNano())/1e9))
+		}
+	}
+
+	if options.openMetrics {
+		writer.WriteString("# EOF\n")
+	}
 }
 
 func (pc *PrometheusCounter) Inc() common.Counter {
@@ -91,47 +445,124 @@ func (pc *PrometheusCounter) Add(value int) common.Counter {
 	return pc
 }
 
+func (pc *PrometheusCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+
+	pc.Add(value)
+	if value >= 0 {
+		pc.meter.exemplar(pc.set, pc.ident, float64(value), span)
+	}
+	return pc
+}
+
 func (p *PrometheusMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
 
-	ident := p.buildIdent(name, labels, prefixes...)
+	id := ""
+	var s *metrics.Set
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		id = ident
+		s = set
+		return set.GetOrCreateCounter(ident)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
+	}
 
-	set := metrics.GetDefaultSet()
-	gr := p.findGroup(group)
-	if gr != nil {
-		set = gr.set
+	return &PrometheusCounter{
+		meter:   p,
+		set:     s,
+		ident:   id,
+		counter: m.(*metrics.Counter),
 	}
+}
+
+func (pfc *PrometheusFloatCounter) Add(value float64) common.FloatCounter {
 
-	counter := &PrometheusCounter{
+	pfc.counter.Add(value)
+	return pfc
+}
+
+func (p *PrometheusMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		return set.GetOrCreateFloatCounter(ident)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
+	}
+
+	return &PrometheusFloatCounter{
 		meter:   p,
-		counter: set.GetOrCreateCounter(ident),
+		counter: m.(*metrics.FloatCounter),
 	}
-	return counter
 }
 
 func (pg *PrometheusGauge) Set(value float64) common.Gauge {
 
-	pg.value = value
+	pg.gauge.Set(value)
 	return pg
 }
 
-func (p *PrometheusMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+func (pg *PrometheusGauge) Add(value float64) common.Gauge {
 
-	ident := p.buildIdent(name, labels, prefixes...)
+	pg.gauge.Add(value)
+	return pg
+}
 
-	set := metrics.GetDefaultSet()
-	gr := p.findGroup(group)
-	if gr != nil {
-		set = gr.set
+func (pg *PrometheusGauge) Sub(value float64) common.Gauge {
+
+	pg.gauge.Add(-value)
+	return pg
+}
+
+func (pg *PrometheusGauge) Inc() common.Gauge {
+
+	pg.gauge.Inc()
+	return pg
+}
+
+func (pg *PrometheusGauge) Dec() common.Gauge {
+
+	pg.gauge.Dec()
+	return pg
+}
+
+func (p *PrometheusMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		// gauge with callback panics on set
+		if _, ok := p.observables.Load(prometheusObservable{set: set, ident: ident}); ok {
+			panic("gauge is observable, it can't be set")
+		}
+		return set.GetOrCreateGauge(ident, nil)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
 	}
 
-	var gauge *PrometheusGauge
-	gauge = &PrometheusGauge{
+	return &PrometheusGauge{
 		meter: p,
-		gauge: set.GetOrCreateGauge(ident, func() float64 {
-			return gauge.value
-		}),
+		gauge: m.(*metrics.Gauge),
+	}
+}
+
+func (p *PrometheusMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	_, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		key := prometheusObservable{set: set, ident: ident}
+		if _, ok := p.observables.Load(key); ok {
+			return set.GetOrCreateGauge(ident, callback)
+		}
+		// callback is called on every scrape, gauge without callback can't get it
+		gauge := set.NewGauge(ident, callback)
+		p.observables.Store(key, true)
+		return gauge
+	})
+	if err != nil {
+		p.logger.Error(err)
 	}
-	return gauge
 }
 
 func (ph *PrometheusHistogram) Observe(value float64) common.Histogram {
@@ -143,23 +574,127 @@ func (ph *PrometheusHistogram) Observe(value float64) common.Histogram {
 	return ph
 }
 
+// bucket returns series line of classic histogram bucket for value
+func (ph *PrometheusHistogram) bucket(value float64) string {
+
+	le := `le="+Inf"`
+	for _, b := range ph.bounds {
+		if value <= b {
+			le = fmt.Sprintf(`le="%v"`, b)
+			break
+		}
+	}
+
+	n := strings.IndexByte(ph.ident, '{')
+	if n < 0 {
+		return fmt.Sprintf("%s_bucket{%s}", ph.ident, le)
+	}
+	return fmt.Sprintf("%s_bucket%s,%s}", ph.ident[:n], strings.TrimSuffix(ph.ident[n:], "}"), le)
+}
+
+// ObserveWithSpan keeps exemplar only for histograms with buckets, as vmrange is not supported by OpenMetrics
+func (ph *PrometheusHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+
+	ph.Observe(value)
+	if len(ph.bounds) > 0 && !math.IsNaN(value) && !math.IsInf(value, 0) {
+		ph.meter.exemplar(ph.set, ph.bucket(value), value, span)
+	}
+	return ph
+}
+
 func (p *PrometheusMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
-	ident := p.buildIdent(name, labels, prefixes...)
 
-	set := metrics.GetDefaultSet()
-	gr := p.findGroup(group)
-	if gr != nil {
-		set = gr.set
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		// VictoriaMetrics histogram with vmrange buckets
+		return set.GetOrCreateHistogram(ident)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
 	}
 
-	// Note: VictoriaMetrics histogram implementation doesn't support custom buckets
-	h := set.GetOrCreateHistogram(ident)
+	return &PrometheusHistogram{
+		meter:     p,
+		histogram: m.(*metrics.Histogram),
+	}
+}
+
+func (p *PrometheusMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	if len(buckets) == 0 {
+		return p.Histogram(group, name, description, labels, prefixes...)
+	}
+
+	bounds := make([]float64, len(buckets))
+	copy(bounds, buckets)
+	sort.Float64s(bounds)
 
-	histogram := &PrometheusHistogram{
+	err := metrics.ValidateBuckets(bounds)
+	if err != nil {
+		p.logger.Error(err)
+		return nil
+	}
+
+	id := ""
+	var s *metrics.Set
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		id = ident
+		s = set
+		// classic histogram with le buckets
+		return set.GetOrCreatePrometheusHistogramExt(ident, bounds)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
+	}
+
+	return &PrometheusHistogram{
 		meter:     p,
-		histogram: h,
+		set:       s,
+		ident:     id,
+		bounds:    bounds,
+		histogram: m.(*metrics.PrometheusHistogram),
+	}
+}
+
+func (ps *PrometheusSummary) Observe(value float64) common.Summary {
+
+	if !math.IsNaN(value) && !math.IsInf(value, 0) {
+
+		ps.summary.Update(value)
+	}
+	return ps
+}
+
+func (p *PrometheusMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	if len(quantiles) == 0 {
+		quantiles = prometheusSummaryQuantiles
+	}
+
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			p.logger.Error("quantile must be in the range [0..1]; got %v", q)
+			return nil
+		}
+	}
+
+	if window <= 0 {
+		window = prometheusSummaryWindow
+	}
+
+	m, err := p.create(group, name, description, labels, prefixes, func(set *metrics.Set, ident string) interface{} {
+		return set.GetOrCreateSummaryExt(ident, window, quantiles)
+	})
+	if err != nil {
+		p.logger.Error(err)
+		return nil
+	}
+
+	return &PrometheusSummary{
+		meter:   p,
+		summary: m.(*metrics.Summary),
 	}
-	return histogram
 }
 
 func (p *PrometheusMeter) findGroup(name string) *PrometheusGroup {
@@ -190,21 +725,168 @@ func (p *PrometheusMeter) Group(name string) common.Group {
 	return group
 }
 
+// prometheusAccepts checks if Accept like header lists value without q=0
+func prometheusAccepts(header, value string) bool {
+
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), value) {
+			continue
+		}
+		for _, param := range params[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || q <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// pushGroupingKey encodes value by base64 if it can't be a path segment, empty value is encoded as single =
+func prometheusPushGroupingKey(name, value string) string {
+
+	if utils.IsEmpty(value) {
+		return fmt.Sprintf("%s@base64/=", name)
+	}
+	if strings.Contains(value, "/") {
+		return fmt.Sprintf("%s@base64/%s", name, base64.URLEncoding.EncodeToString([]byte(value)))
+	}
+	return fmt.Sprintf("%s/%s", name, url.PathEscape(value))
+}
+
+func (p *PrometheusMeter) pushURL() (string, error) {
+
+	job := p.options.PushJob
+	if utils.IsEmpty(job) {
+		job = p.options.Prefix
+	}
+	if utils.IsEmpty(job) {
+		return "", errors.New("prometheus push job is empty")
+	}
+
+	u := fmt.Sprintf("%s/metrics/%s", strings.TrimSuffix(p.options.PushURL, "/"), prometheusPushGroupingKey("job", job))
+	if !utils.IsEmpty(p.options.PushInstance) {
+		u = fmt.Sprintf("%s/%s", u, prometheusPushGroupingKey("instance", p.options.PushInstance))
+	}
+	return u, nil
+}
+
+// Push sends default and group sets to Pushgateway,
+// PUT replaces all metrics of grouping key, POST replaces only metrics with the same names
+func (p *PrometheusMeter) Push() error {
+
+	u, err := p.pushURL()
+	if err != nil {
+		return err
+	}
+
+	method := strings.ToUpper(p.options.PushMethod)
+	if utils.IsEmpty(method) {
+		method = http.MethodPut
+	}
+
+	var bb bytes.Buffer
+	p.writeMetrics(&bb, prometheusWriteOptions{processMetrics: p.options.GoRuntime})
+
+	req, err := http.NewRequest(method, u, &bb)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", PrometheusContentTypeText)
+	if !utils.IsEmpty(p.options.PushUsername) {
+		req.SetBasicAuth(p.options.PushUsername, p.options.PushPassword)
+	}
+
+	started := time.Now()
+	client := &http.Client{Timeout: prometheusPushTimeout}
+	resp, err := client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(resp.Body)
+			err = fmt.Errorf("prometheus pushgateway responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+	}
+	common.GetTelemetry().Export("prometheus", common.TelemetryMetrics, started, err)
+	return err
+}
+
+func (p *PrometheusMeter) push() {
+
+	defer p.pushWG.Done()
+
+	if p.options.PushInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.options.PushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.pushStop:
+			return
+		case <-ticker.C:
+			if err := p.Push(); err != nil {
+				p.logger.Error(err)
+			}
+		}
+	}
+}
+
 func (p *PrometheusMeter) Start() bool {
 
+	if !utils.IsEmpty(p.options.PushURL) {
+		p.logger.Info("Start prometheus push to %s...", p.options.PushURL)
+		p.pushWG.Add(1)
+		go p.push()
+	}
+
+	if p.remoteWriter != nil {
+		p.logger.Info("Start prometheus remote write to %s...", p.options.RemoteWriteURL)
+		p.remoteWriter.Start()
+	}
+
+	// short-lived jobs might not need endpoint
+	if utils.IsEmpty(p.options.Listen) && (!utils.IsEmpty(p.options.PushURL) || p.remoteWriter != nil) {
+		return true
+	}
+
 	p.logger.Info("Start prometheus endpoint...")
 
 	http.HandleFunc(p.options.URL, func(w http.ResponseWriter, req *http.Request) {
 
-		if p.options.GoRuntime {
-			metrics.WritePrometheus(w, true)
+		options := prometheusWriteOptions{
+			processMetrics: p.options.GoRuntime,
+			openMetrics:    prometheusAccepts(req.Header.Get("Accept"), "application/openmetrics-text"),
+			names:          make(map[string]bool),
+		}
+
+		// partial scrape by name[]=family
+		for _, name := range req.URL.Query()["name[]"] {
+			options.names[name] = true
+		}
+
+		if options.openMetrics {
+			w.Header().Set("Content-Type", PrometheusContentTypeOpenMetrics)
 		} else {
-			metrics.WritePrometheus(w, false)
+			w.Header().Set("Content-Type", PrometheusContentTypeText)
 		}
-		//metrics.ExposeMetadata(true)
-		//defer metrics.ExposeMetadata(false)
 
-		//metrics.WritePrometheus(w, false)
+		var writer io.Writer = w
+		if prometheusAccepts(req.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			writer = gz
+		}
+		p.writeMetrics(writer, options)
 	})
 
 	listener, err := net.Listen("tcp", p.options.Listen)
@@ -234,21 +916,78 @@ func (p *PrometheusMeter) StartInWaitGroup(wg *sync.WaitGroup) {
 }
 
 func (p *PrometheusMeter) Stop() {
-	if p.listener != nil {
-		l := *p.listener
-		l.Close()
+
+	err := p.Shutdown(context.Background())
+	if err != nil {
+		p.logger.Error(err)
 	}
 }
 
+// Flush pushes and writes the current snapshot, endpoint has nothing to flush
+func (p *PrometheusMeter) Flush(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+
+		var errs []error
+		if !utils.IsEmpty(p.options.PushURL) {
+			errs = append(errs, p.Push())
+		}
+		if p.remoteWriter != nil {
+			errs = append(errs, p.remoteWriter.export())
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// Shutdown pushes and writes the last snapshots, then closes endpoint
+func (p *PrometheusMeter) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+
+		var err error
+		if !utils.IsEmpty(p.options.PushURL) {
+			p.pushOnce.Do(func() {
+				close(p.pushStop)
+				p.pushWG.Wait()
+				// the last push for metrics collected after the previous one
+				err = p.Push()
+			})
+		}
+
+		if p.remoteWriter != nil {
+			p.remoteWriter.Stop()
+		}
+
+		if p.listener != nil {
+			l := *p.listener
+			l.Close()
+		}
+		return err
+	})
+}
+
 func NewPrometheusMeter(options PrometheusOptions, logger common.Logger, stdout *Stdout) *PrometheusMeter {
 
 	if logger == nil {
 		logger = stdout
 	}
 
-	return &PrometheusMeter{
-		options: options,
-		logger:  logger,
-		groups:  &sync.Map{},
+	// TYPE and HELP lines
+	metrics.ExposeMetadata(true)
+
+	meter := &PrometheusMeter{
+		options:      options,
+		logger:       logger,
+		groups:       &sync.Map{},
+		descriptions: &sync.Map{},
+		exemplars:    &sync.Map{},
+		created:      &sync.Map{},
+		observables:  &sync.Map{},
+		pushStop:     make(chan struct{}),
+	}
+
+	if !utils.IsEmpty(options.RemoteWriteURL) {
+		meter.remoteWriter = NewPrometheusRemoteWriter(meter)
 	}
+	return meter
 }
@@ -1,9 +1,11 @@
 package provider
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"sync"
@@ -138,3 +140,726 @@ func TestPrometheusWrongListen(t *testing.T) {
 		t.Fatal("Invalid startup option")
 	}
 }
+
+func TestPrometheusHistogramWithBuckets(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/buckets"
+	port := 9997
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	if prometheus.HistogramWithBuckets("", "wrong", "description", nil, []float64{1, 1}, "buckets") != nil {
+		t.Fatal("Duplicate buckets are accepted")
+	}
+
+	histogram := prometheus.HistogramWithBuckets("", "latency", "description", nil, []float64{1, 0.1, 0.5}, "buckets")
+	if histogram == nil {
+		t.Fatal("Invalid histogram")
+	}
+	histogram.Observe(0.05)
+	histogram.Observe(0.3)
+	histogram.Observe(2)
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`test_buckets_latency_bucket{le="0.1"} 1`,
+		`test_buckets_latency_bucket{le="0.5"} 2`,
+		`test_buckets_latency_bucket{le="1"} 2`,
+		`test_buckets_latency_bucket{le="+Inf"} 3`,
+		`test_buckets_latency_count 3`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(content), e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+}
+
+func TestPrometheusMetadata(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/metadata"
+	port := 9996
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	prometheus.Counter("", "requests", "Requests with \\ and\nnew line", common.Labels{"code": "200"}, "metadata").Inc()
+	prometheus.Gauge("", "temperature", "Current temperature", nil, "metadata").Set(1)
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`# HELP test_metadata_requests Requests with \\ and\nnew line`,
+		`# TYPE test_metadata_requests counter`,
+		`# HELP test_metadata_temperature Current temperature`,
+		`# TYPE test_metadata_temperature gauge`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(content), e+"\n") {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+}
+
+func TestPrometheusSummary(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/summary"
+	port := 9995
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	if prometheus.Summary("", "wrong", "description", nil, []float64{1.5}, time.Minute, "summary") != nil {
+		t.Fatal("Wrong quantile is accepted")
+	}
+
+	summary := prometheus.Summary("", "latency", "description", nil, []float64{0.5, 0.99}, time.Minute, "summary")
+	if summary == nil {
+		t.Fatal("Invalid summary")
+	}
+	for i := 1; i <= 100; i++ {
+		summary.Observe(float64(i))
+	}
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`# TYPE test_summary_latency summary`,
+		`test_summary_latency{quantile="0.5"}`,
+		`test_summary_latency{quantile="0.99"}`,
+		`test_summary_latency_count 100`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(content), e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+}
+
+func TestPrometheusGauge(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/gauge"
+	port := 9994
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	gauge := prometheus.Gauge("", "inflight", "description", nil, "gauge")
+	if gauge == nil {
+		t.Fatal("Invalid gauge")
+	}
+	gauge.Set(10)
+
+	var workers sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			gauge.Inc().Add(2.5)
+			gauge.Dec().Sub(0.5)
+		}()
+	}
+	workers.Wait()
+
+	prometheus.ObservableGauge("", "observed", "description", nil, func() float64 {
+		return 42
+	}, "gauge")
+
+	// observable gauge can't be set, gauge can't get callback
+	if prometheus.Gauge("", "observed", "description", nil, "gauge") != nil {
+		t.Fatal("Observable gauge is returned as gauge")
+	}
+	prometheus.ObservableGauge("", "inflight", "description", nil, func() float64 {
+		return 42
+	}, "gauge")
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"test_gauge_inflight 210\n",
+		"test_gauge_observed 42\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(content), e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+}
+
+func TestPrometheusFloatCounter(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/float"
+	port := 9993
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	counter := prometheus.FloatCounter("", "bytes", "description", nil, "float")
+	if counter == nil {
+		t.Fatal("Invalid float counter")
+	}
+	counter.Add(1.25).Add(2.5)
+
+	prometheus.Counter("", "requests", "description", nil, "float").Add(2)
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# TYPE test_float_bytes counter\n",
+		"test_float_bytes 3.75\n",
+		"test_float_requests 2\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(content), e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+}
+
+func TestPrometheusNaming(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/naming"
+	port := 9992
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	counter := prometheus.Counter("", "http-requests", "description", common.Labels{"path": "/a\"b\nc"}, "naming")
+	if counter == nil {
+		t.Fatal("Invalid counter")
+	}
+	counter.Inc()
+
+	if prometheus.Counter("", "wrong", "description", common.Labels{"__name__": "x"}, "naming") != nil {
+		t.Fatal("Reserved label is accepted")
+	}
+
+	// the same ident with another type should not panic
+	if prometheus.Gauge("", "http-requests", "description", common.Labels{"path": "/a\"b\nc"}, "naming") != nil {
+		t.Fatal("Gauge over counter is accepted")
+	}
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `test_naming_http_requests{path="/a\"b\nc"} 1` + "\n"
+	if !strings.Contains(string(content), expected) {
+		t.Fatalf("No %s in output", expected)
+	}
+}
+
+type prometheusTestSpanContext struct {
+	traceID string
+	spanID  string
+}
+
+func (sc *prometheusTestSpanContext) GetTraceID() string {
+	return sc.traceID
+}
+
+func (sc *prometheusTestSpanContext) GetSpanID() string {
+	return sc.spanID
+}
+
+func prometheusGet(t *testing.T, url, accept string) (string, string) {
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content), r.Header.Get("Content-Type")
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/exemplars"
+	port := 9991
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	span := &prometheusTestSpanContext{traceID: "0af7651916cd43dd", spanID: "b7ad6b71"}
+
+	counter := prometheus.Counter("", "requests", "Requests", common.Labels{"code": "200"}, "exemplars")
+	counter.AddWithSpan(2, span).AddWithSpan(1, nil)
+
+	histogram := prometheus.HistogramWithBuckets("", "latency", "Latency", nil, []float64{0.1, 0.5}, "exemplars")
+	histogram.ObserveWithSpan(0.3, span)
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	url := fmt.Sprintf("http://localhost:%d%s", port, URL)
+
+	content, contentType := prometheusGet(t, url, "")
+	if !strings.HasPrefix(contentType, "text/plain") {
+		t.Fatalf("Wrong content type: %s", contentType)
+	}
+	if strings.Contains(content, "trace_id") || strings.Contains(content, "# EOF") {
+		t.Fatal("OpenMetrics is in text output")
+	}
+
+	content, contentType = prometheusGet(t, url, "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Fatalf("Wrong content type: %s", contentType)
+	}
+
+	expected := []string{
+		"# TYPE test_exemplars_requests counter\n",
+		`test_exemplars_requests_total{code="200"} 3 # {trace_id="0af7651916cd43dd",span_id="b7ad6b71"} 2 `,
+		`test_exemplars_latency_bucket{le="0.5"} 1 # {trace_id="0af7651916cd43dd",span_id="b7ad6b71"} 0.3 `,
+		"# EOF\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(content, e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+
+	if strings.Contains(content, `le="0.1"} 0 #`) {
+		t.Fatal("Exemplar is in wrong bucket")
+	}
+
+	exemplars := func() int {
+		n := 0
+		prometheus.exemplars.Range(func(key, value interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	group := prometheus.Group("grouped")
+	prometheus.Counter("grouped", "requests", "Requests", nil, "exemplars").AddWithSpan(1, span)
+	if n := exemplars(); n != 3 {
+		t.Fatalf("Wrong number of exemplars: %d", n)
+	}
+
+	// clearing group forgets its exemplars only
+	group.Clear()
+	if n := exemplars(); n != 2 {
+		t.Fatalf("Exemplars of cleared group are kept: %d", n)
+	}
+}
+
+func TestPrometheusOpenMetrics(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	URL := "/openmetrics"
+	port := 9990
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		URL:    URL,
+		Listen: fmt.Sprintf(":%d", port),
+		Prefix: "test",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	prometheus.FloatCounter("", "work_seconds", "Work time", nil, "openmetrics").Add(1.5)
+	prometheus.Gauge("", "queue", "Queue", nil, "openmetrics").Set(3)
+
+	time.Sleep(time.Duration(1) * time.Second)
+
+	url := fmt.Sprintf("http://localhost:%d%s?name[]=test_openmetrics_work_seconds", port, URL)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/openmetrics-text")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Response is not compressed")
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+
+	expected := []string{
+		"# HELP test_openmetrics_work_seconds Work time\n",
+		"# TYPE test_openmetrics_work_seconds counter\n",
+		"# UNIT test_openmetrics_work_seconds seconds\n",
+		"test_openmetrics_work_seconds_total 1.5\n",
+		"test_openmetrics_work_seconds_created ",
+	}
+	for _, e := range expected {
+		if !strings.Contains(content, e) {
+			t.Fatalf("No %s in output", e)
+		}
+	}
+
+	if strings.Contains(content, "test_openmetrics_queue") {
+		t.Fatal("Filtered metric is in output")
+	}
+
+	if !strings.HasSuffix(content, "# EOF\n") {
+		t.Fatal("No EOF in output")
+	}
+}
+
+func TestPrometheusPush(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	type push struct {
+		method string
+		path   string
+		user   string
+		body   string
+	}
+
+	var mutex sync.Mutex
+	var pushes []push
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		pushes = append(pushes, push{method: r.Method, path: r.URL.EscapedPath(), user: user, body: string(body)})
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		Prefix:       "test",
+		PushURL:      server.URL,
+		PushJob:      "cron",
+		PushInstance: "host/1",
+		PushInterval: time.Millisecond * 100,
+		PushMethod:   "post",
+		PushUsername: "user",
+		PushPassword: "password",
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+
+	time.Sleep(time.Millisecond * 300)
+	prometheus.Group("push")
+	prometheus.Counter("push", "done", "Done", nil, "push").Inc()
+	prometheus.Stop()
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(pushes) < 2 {
+		t.Fatalf("Wrong number of pushes: %d", len(pushes))
+	}
+
+	last := pushes[len(pushes)-1]
+	if last.method != http.MethodPost {
+		t.Fatalf("Wrong method: %s", last.method)
+	}
+	if last.path != "/metrics/job/cron/instance@base64/aG9zdC8x" {
+		t.Fatalf("Wrong path: %s", last.path)
+	}
+	if last.user != "user" {
+		t.Fatalf("Wrong user: %s", last.user)
+	}
+	if !strings.Contains(last.body, "test_push_done 1\n") {
+		t.Fatal("No group metric in the last push")
+	}
+}
+
+func TestPrometheusAccepts(t *testing.T) {
+
+	cases := map[string]bool{
+		"gzip":                 true,
+		"deflate, gzip;q=0.5":  true,
+		"GZIP ; q=1":           true,
+		"gzip;q=0":             false,
+		"gzip; q=0.0, deflate": false,
+		"deflate, x-gzip":      false,
+		"":                     false,
+	}
+	for header, expected := range cases {
+		if prometheusAccepts(header, "gzip") != expected {
+			t.Fatalf("Wrong gzip acceptance of %q, expected %v", header, expected)
+		}
+	}
+
+	if !prometheusAccepts("application/openmetrics-text;version=1.0.0,text/plain;q=0.5", "application/openmetrics-text") {
+		t.Fatal("OpenMetrics is not accepted")
+	}
+}
+
+func TestPrometheusPushGroupingKey(t *testing.T) {
+
+	cases := map[string]string{
+		"host":   "instance/host",
+		"host/1": "instance@base64/aG9zdC8x",
+		"":       "instance@base64/=",
+	}
+	for value, expected := range cases {
+		if key := prometheusPushGroupingKey("instance", value); key != expected {
+			t.Fatalf("Wrong grouping key %s, expected %s", key, expected)
+		}
+	}
+}
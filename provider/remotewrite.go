@@ -0,0 +1,460 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	PrometheusRemoteWriteDefaultQueueSize = 100
+	PrometheusRemoteWriteDefaultRetries   = 3
+	prometheusRemoteWriteTimeout          = time.Second * 10
+	prometheusRemoteWriteMinBackoff       = time.Millisecond * 100
+)
+
+type prometheusRemoteLabel struct {
+	name  string
+	value string
+}
+
+type prometheusRemoteSeries struct {
+	labels []prometheusRemoteLabel
+	value  float64
+}
+
+type prometheusRemoteBatch struct {
+	payload []byte
+	samples int
+}
+
+// PrometheusRemoteWriter snapshots metrics of the meter and sends them by remote_write protocol,
+// batches which failed to be sent are kept in queue until the next interval
+type PrometheusRemoteWriter struct {
+	meter   *PrometheusMeter
+	labels  []prometheusRemoteLabel
+	client  *http.Client
+	queue   []*prometheusRemoteBatch
+	mutex   sync.Mutex
+	sending sync.Mutex
+	stop    chan struct{}
+	once    sync.Once
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type prometheusRemoteError struct {
+	err       error
+	retryable bool
+}
+
+func (e *prometheusRemoteError) Error() string {
+	return e.err.Error()
+}
+
+func prometheusRemoteUnescape(s string) string {
+
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// prometheusRemoteParseLabels parses `name="value",...` with escaped values
+func prometheusRemoteParseLabels(s string) ([]prometheusRemoteLabel, error) {
+
+	var labels []prometheusRemoteLabel
+	for len(s) > 0 {
+
+		n := strings.IndexByte(s, '=')
+		if n < 0 || n+1 >= len(s) || s[n+1] != '"' {
+			return nil, fmt.Errorf("wrong labels %q", s)
+		}
+		name := strings.TrimSpace(s[:n])
+		s = s[n+2:]
+
+		end := -1
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("wrong label value of %s", name)
+		}
+
+		labels = append(labels, prometheusRemoteLabel{name: name, value: prometheusRemoteUnescape(s[:end])})
+		s = strings.TrimPrefix(s[end+1:], ",")
+	}
+	return labels, nil
+}
+
+// prometheusRemoteParse converts text exposition format into series
+func prometheusRemoteParse(text string) ([]*prometheusRemoteSeries, error) {
+
+	var series []*prometheusRemoteSeries
+	for _, line := range strings.Split(text, "\n") {
+
+		if utils.IsEmpty(line) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		n := strings.LastIndexByte(line, ' ')
+		if n < 0 {
+			return nil, fmt.Errorf("wrong line %q", line)
+		}
+
+		value, err := strconv.ParseFloat(line[n+1:], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		name, lbs := prometheusSplitSeries(line[:n])
+		labels := []prometheusRemoteLabel{{name: "__name__", value: name}}
+		if !utils.IsEmpty(lbs) {
+			l, err := prometheusRemoteParseLabels(lbs[1 : len(lbs)-1])
+			if err != nil {
+				return nil, err
+			}
+			labels = append(labels, l...)
+		}
+
+		series = append(series, &prometheusRemoteSeries{labels: labels, value: value})
+	}
+	return series, nil
+}
+
+// prometheusRemoteEncode encodes prometheus.WriteRequest protobuf message
+func prometheusRemoteEncode(series []*prometheusRemoteSeries, timestamp int64) []byte {
+
+	var request []byte
+	for _, s := range series {
+
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, ts)
+	}
+	return request
+}
+
+// prometheusRemoteExternal adds external labels which series doesn't have, as Prometheus does
+func prometheusRemoteExternal(labels, external []prometheusRemoteLabel) []prometheusRemoteLabel {
+
+	names := make(map[string]bool)
+	for _, l := range labels {
+		names[l.name] = true
+	}
+	for _, l := range external {
+		if !names[l.name] {
+			labels = append(labels, l)
+		}
+	}
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	return labels
+}
+
+func (rw *PrometheusRemoteWriter) snapshot() (*prometheusRemoteBatch, error) {
+
+	var bb bytes.Buffer
+	rw.meter.writeMetrics(&bb, prometheusWriteOptions{processMetrics: rw.meter.options.GoRuntime})
+
+	series, err := prometheusRemoteParse(bb.String())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range series {
+		s.labels = prometheusRemoteExternal(s.labels, rw.labels)
+	}
+
+	payload := prometheusRemoteEncode(series, time.Now().UnixMilli())
+	return &prometheusRemoteBatch{
+		payload: snappy.Encode(nil, payload),
+		samples: len(series),
+	}, nil
+}
+
+func (rw *PrometheusRemoteWriter) send(batch *prometheusRemoteBatch) error {
+
+	options := rw.meter.options
+
+	req, err := http.NewRequest(http.MethodPost, options.RemoteWriteURL, bytes.NewReader(batch.payload))
+	if err != nil {
+		return &prometheusRemoteError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", fmt.Sprintf("sre/%s", options.Version))
+	if !utils.IsEmpty(options.RemoteWriteUsername) {
+		req.SetBasicAuth(options.RemoteWriteUsername, options.RemoteWritePassword)
+	}
+
+	started := time.Now()
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		common.GetTelemetry().Export("prometheus", common.TelemetryMetrics, started, err)
+		return &prometheusRemoteError{err: err, retryable: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		err = fmt.Errorf("prometheus remote write responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	common.GetTelemetry().Export("prometheus", common.TelemetryMetrics, started, err)
+
+	if err != nil {
+		// only server errors and throttling are worth to retry
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return &prometheusRemoteError{err: err, retryable: retryable}
+	}
+	return nil
+}
+
+func (rw *PrometheusRemoteWriter) sendWithRetry(batch *prometheusRemoteBatch) error {
+
+	backoff := prometheusRemoteWriteMinBackoff
+	var err error
+
+	for i := 0; i <= rw.meter.options.RemoteWriteRetries; i++ {
+		if i > 0 {
+			select {
+			case <-rw.stop:
+				return err
+			case <-time.After(backoff):
+			}
+			backoff = backoff * 2
+		}
+
+		err = rw.send(batch)
+		if err == nil {
+			return nil
+		}
+		if re, ok := err.(*prometheusRemoteError); ok && !re.retryable {
+			return err
+		}
+	}
+	return err
+}
+
+func (rw *PrometheusRemoteWriter) enqueue(batch *prometheusRemoteBatch) {
+
+	dropped := 0
+
+	rw.mutex.Lock()
+	rw.queue = append(rw.queue, batch)
+	for len(rw.queue) > rw.meter.options.RemoteWriteQueueSize {
+		// drop the oldest batch to keep the latest ones
+		dropped = dropped + rw.queue[0].samples
+		rw.queue = rw.queue[1:]
+	}
+	depth := len(rw.queue)
+	rw.mutex.Unlock()
+
+	t := common.GetTelemetry()
+	t.Queued("prometheus", common.TelemetryMetrics, batch.samples)
+	t.Dropped("prometheus", common.TelemetryMetrics, dropped)
+	t.QueueDepth("prometheus", common.TelemetryMetrics, depth)
+}
+
+// Flush sends queued batches in order, stops on the first batch which is worth to retry later,
+// flushes of ticker and meter are serialized, so a batch is sent once
+func (rw *PrometheusRemoteWriter) Flush() error {
+
+	rw.sending.Lock()
+	defer rw.sending.Unlock()
+
+	t := common.GetTelemetry()
+
+	for {
+		rw.mutex.Lock()
+		if len(rw.queue) == 0 {
+			rw.mutex.Unlock()
+			return nil
+		}
+		batch := rw.queue[0]
+		rw.mutex.Unlock()
+
+		err := rw.sendWithRetry(batch)
+
+		if err != nil {
+			if re, ok := err.(*prometheusRemoteError); ok && re.retryable {
+				return err
+			}
+			t.Failed("prometheus", common.TelemetryMetrics, batch.samples)
+		} else {
+			t.Sent("prometheus", common.TelemetryMetrics, batch.samples)
+		}
+
+		rw.mutex.Lock()
+		if len(rw.queue) > 0 && rw.queue[0] == batch {
+			rw.queue = rw.queue[1:]
+		}
+		depth := len(rw.queue)
+		rw.mutex.Unlock()
+
+		t.QueueDepth("prometheus", common.TelemetryMetrics, depth)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// export queues the current snapshot and sends the queue
+func (rw *PrometheusRemoteWriter) export() error {
+
+	batch, err := rw.snapshot()
+	if err != nil {
+		return err
+	}
+	rw.enqueue(batch)
+	return rw.Flush()
+}
+
+func (rw *PrometheusRemoteWriter) write() {
+
+	if err := rw.export(); err != nil {
+		rw.meter.logger.Error(err)
+	}
+}
+
+func (rw *PrometheusRemoteWriter) run() {
+
+	defer rw.wg.Done()
+
+	ticker := time.NewTicker(rw.meter.options.RemoteWriteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rw.stop:
+			return
+		case <-ticker.C:
+			rw.write()
+		}
+	}
+}
+
+func (rw *PrometheusRemoteWriter) Start() {
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.stopped {
+		return
+	}
+	rw.wg.Add(1)
+	go rw.run()
+}
+
+// Stop writes the last snapshot, what is left in queue is dropped
+func (rw *PrometheusRemoteWriter) Stop() {
+
+	rw.once.Do(func() {
+		rw.mutex.Lock()
+		rw.stopped = true
+		rw.mutex.Unlock()
+
+		close(rw.stop)
+		rw.wg.Wait()
+		rw.write()
+
+		rw.mutex.Lock()
+		dropped := 0
+		for _, b := range rw.queue {
+			dropped = dropped + b.samples
+		}
+		rw.queue = nil
+		rw.mutex.Unlock()
+
+		common.GetTelemetry().Dropped("prometheus", common.TelemetryMetrics, dropped)
+	})
+}
+
+func NewPrometheusRemoteWriter(meter *PrometheusMeter) *PrometheusRemoteWriter {
+
+	options := &meter.options
+	if options.RemoteWriteInterval <= 0 {
+		options.RemoteWriteInterval = time.Second * 15
+	}
+	if options.RemoteWriteQueueSize <= 0 {
+		options.RemoteWriteQueueSize = PrometheusRemoteWriteDefaultQueueSize
+	}
+	if options.RemoteWriteRetries < 0 {
+		options.RemoteWriteRetries = PrometheusRemoteWriteDefaultRetries
+	}
+
+	// external labels
+	var labels []prometheusRemoteLabel
+	for name, value := range map[string]string{
+		"service":     options.ServiceName,
+		"version":     options.Version,
+		"environment": options.Environment,
+	} {
+		if !utils.IsEmpty(value) {
+			labels = append(labels, prometheusRemoteLabel{name: name, value: value})
+		}
+	}
+
+	return &PrometheusRemoteWriter{
+		meter:  meter,
+		labels: labels,
+		client: &http.Client{Timeout: prometheusRemoteWriteTimeout},
+		stop:   make(chan struct{}),
+	}
+}
@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type remoteWriteTestSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+func remoteWriteTestFields(t *testing.T, b []byte, f func(num protowire.Number, v []byte, u uint64)) {
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal("Wrong tag")
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatal("Wrong bytes")
+			}
+			f(num, v, 0)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			u, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				t.Fatal("Wrong fixed64")
+			}
+			f(num, nil, u)
+			b = b[n:]
+		case protowire.VarintType:
+			u, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatal("Wrong varint")
+			}
+			f(num, nil, u)
+			b = b[n:]
+		default:
+			t.Fatalf("Wrong type %d", typ)
+		}
+	}
+}
+
+func remoteWriteTestDecode(t *testing.T, payload []byte) []remoteWriteTestSeries {
+
+	var series []remoteWriteTestSeries
+	remoteWriteTestFields(t, payload, func(_ protowire.Number, ts []byte, _ uint64) {
+
+		s := remoteWriteTestSeries{labels: make(map[string]string)}
+		remoteWriteTestFields(t, ts, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, value string
+				remoteWriteTestFields(t, v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				if _, ok := s.labels[name]; ok {
+					t.Fatalf("Duplicate label %s", name)
+				}
+				s.labels[name] = value
+			case 2:
+				remoteWriteTestFields(t, v, func(num protowire.Number, _ []byte, u uint64) {
+					if num == 1 {
+						s.value = math.Float64frombits(u)
+					}
+				})
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+func TestPrometheusRemoteWrite(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	var mutex sync.Mutex
+	var payloads [][]byte
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests++
+		// the first request fails to check retry
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		payload, err := snappy.Decode(nil, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		Prefix:              "test",
+		Version:             "1.0",
+		ServiceName:         "edge",
+		Environment:         "test",
+		RemoteWriteURL:      server.URL,
+		RemoteWriteInterval: time.Millisecond * 100,
+		RemoteWriteRetries:  2,
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+
+	prometheus.Group("remote")
+	prometheus.Counter("remote", "done", "Done", map[string]string{"path": `a"b`}, "remote").Add(3)
+	prometheus.Counter("remote", "proxied", "Proxied", map[string]string{"service": "api"}, "remote").Add(1)
+
+	time.Sleep(time.Millisecond * 300)
+	prometheus.Stop()
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(payloads) == 0 {
+		t.Fatal("No remote writes")
+	}
+
+	found := false
+	for _, s := range remoteWriteTestDecode(t, payloads[len(payloads)-1]) {
+		// own label of series is kept instead of external one
+		if s.labels["__name__"] == "test_remote_proxied" && s.labels["service"] != "api" {
+			t.Fatalf("External label overrides series label: %v", s.labels)
+		}
+		if s.labels["__name__"] != "test_remote_done" {
+			continue
+		}
+		found = true
+
+		if s.value != 3 {
+			t.Fatalf("Wrong value: %v", s.value)
+		}
+		if s.labels["path"] != `a"b` {
+			t.Fatalf("Wrong label: %s", s.labels["path"])
+		}
+		if s.labels["service"] != "edge" || s.labels["version"] != "1.0" || s.labels["environment"] != "test" {
+			t.Fatalf("Wrong external labels: %v", s.labels)
+		}
+	}
+	if !found {
+		t.Fatal("No remote write series")
+	}
+}
+
+func TestPrometheusRemoteWriteWithPush(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	var mutex sync.Mutex
+	writes := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Header.Get("Content-Encoding") == "snappy" {
+			mutex.Lock()
+			writes++
+			mutex.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// without endpoint, push must not prevent remote write from running
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		Prefix:              "test",
+		PushURL:             server.URL,
+		PushInterval:        time.Hour,
+		RemoteWriteURL:      server.URL,
+		RemoteWriteInterval: time.Millisecond * 100,
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	var wg sync.WaitGroup
+	prometheus.StartInWaitGroup(&wg)
+	defer prometheus.Stop()
+
+	time.Sleep(time.Millisecond * 300)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if writes == 0 {
+		t.Fatal("Remote write is not started with push")
+	}
+}
+
+func TestPrometheusRemoteWriteFlush(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	var mutex sync.Mutex
+	writes := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		mutex.Lock()
+		writes++
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond * 100)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prometheus := NewPrometheusMeter(PrometheusOptions{
+		Prefix:         "test",
+		RemoteWriteURL: server.URL,
+	}, nil, stdout)
+	if prometheus == nil {
+		t.Fatal("Invalid prometheus")
+	}
+
+	batch, err := prometheus.remoteWriter.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.remoteWriter.enqueue(batch)
+
+	// concurrent flushes must send the batch once
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prometheus.remoteWriter.Flush()
+		}()
+	}
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if writes != 1 {
+		t.Fatalf("Wrong number of remote writes %d, expected 1", writes)
+	}
+}
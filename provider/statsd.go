@@ -0,0 +1,525 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/sre/common"
+	utils "github.com/devopsext/utils"
+)
+
+const (
+	StatsdDialectNone      = "none"
+	StatsdDialectDogStatsD = "dogstatsd"
+	StatsdDialectInfluxDB  = "influxdb"
+	StatsdDialectGraphite  = "graphite"
+)
+
+const (
+	StatsdDefaultMTU           = 1432
+	StatsdDefaultFlushInterval = time.Second
+)
+
+type StatsdOptions struct {
+	Host          string
+	Port          int
+	Prefix        string
+	Tags          string
+	Dialect       string
+	MTU           int
+	FlushInterval time.Duration
+	SampleRate    float64
+}
+
+type statsdMetric struct {
+	meter       *StatsdMeter
+	name        string
+	description string
+	suffix      string
+}
+
+type StatsdCounter struct {
+	statsdMetric
+}
+
+type StatsdFloatCounter struct {
+	statsdMetric
+}
+
+type StatsdGauge struct {
+	statsdMetric
+	value MeterGaugeValue
+}
+
+type StatsdHistogram struct {
+	statsdMetric
+}
+
+type StatsdSummary struct {
+	statsdMetric
+}
+
+type statsdPacket struct {
+	data  []byte
+	lines int
+}
+
+type StatsdMeter struct {
+	options     StatsdOptions
+	logger      common.Logger
+	conn        net.Conn
+	buffer      bytes.Buffer
+	lines       int
+	mutex       sync.Mutex
+	gauges      *sync.Map
+	observables *sync.Map
+	observer    *MeterObserver
+	stop        chan struct{}
+	once        sync.Once
+	wg          sync.WaitGroup
+}
+
+func statsdFormat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (sm *StatsdMeter) getTags(labels common.Labels) ([][2]string, error) {
+
+	labels, err := common.StatsdMetricNaming.Labels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags [][2]string
+	for _, v := range strings.Split(sm.options.Tags, ",") {
+		if utils.IsEmpty(v) {
+			continue
+		}
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || utils.IsEmpty(kv[0]) {
+			continue
+		}
+		tags = append(tags, [2]string{strings.TrimSpace(kv[0]), common.StatsdMetricNaming.Value(strings.TrimSpace(kv[1]))})
+	}
+
+	var arr [][2]string
+	for k, v := range labels {
+		arr = append(arr, [2]string{k, v})
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i][0] < arr[j][0]
+	})
+	return append(tags, arr...), nil
+}
+
+// build returns metric name with tags in dialect format and suffix which follows type and rate
+func (sm *StatsdMeter) build(name, description string, labels common.Labels, prefixes ...string) (*statsdMetric, error) {
+
+	var names []string
+
+	names = append(names, sm.options.Prefix)
+	names = append(names, prefixes...)
+	names = append(names, name)
+
+	newName, err := common.StatsdMetricNaming.Name(names...)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := sm.getTags(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []string
+	suffix := ""
+
+	switch sm.options.Dialect {
+	case StatsdDialectDogStatsD:
+		for _, t := range tags {
+			arr = append(arr, fmt.Sprintf("%s:%s", t[0], t[1]))
+		}
+		if len(arr) > 0 {
+			suffix = fmt.Sprintf("|#%s", strings.Join(arr, ","))
+		}
+	case StatsdDialectInfluxDB:
+		for _, t := range tags {
+			arr = append(arr, fmt.Sprintf(",%s=%s", t[0], t[1]))
+		}
+		newName = newName + strings.Join(arr, "")
+	case StatsdDialectGraphite:
+		for _, t := range tags {
+			arr = append(arr, fmt.Sprintf(";%s=%s", t[0], t[1]))
+		}
+		newName = newName + strings.Join(arr, "")
+	}
+
+	return &statsdMetric{
+		meter:       sm,
+		name:        newName,
+		description: description,
+		suffix:      suffix,
+	}, nil
+}
+
+// take moves batched lines into packets, mutex should be held
+func (sm *StatsdMeter) take(packets []statsdPacket) []statsdPacket {
+
+	if sm.buffer.Len() == 0 {
+		return packets
+	}
+
+	data := make([]byte, sm.buffer.Len())
+	copy(data, sm.buffer.Bytes())
+	packets = append(packets, statsdPacket{data: data, lines: sm.lines})
+
+	sm.buffer.Reset()
+	sm.lines = 0
+	return packets
+}
+
+// send is called without mutex, because telemetry might be reported to this meter as well
+func (sm *StatsdMeter) send(packets []statsdPacket) error {
+
+	var errs []error
+	for _, p := range packets {
+
+		started := time.Now()
+		_, err := sm.conn.Write(p.data)
+		common.GetTelemetry().Export("statsd", common.TelemetryMetrics, started, err)
+		if err != nil {
+			common.GetTelemetry().Failed("statsd", common.TelemetryMetrics, p.lines)
+			errs = append(errs, err)
+		} else {
+			common.GetTelemetry().Sent("statsd", common.TelemetryMetrics, p.lines)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// write batches lines into packets which don't exceed MTU
+func (sm *StatsdMeter) write(lines ...string) {
+
+	var packets []statsdPacket
+
+	sm.mutex.Lock()
+	for _, line := range lines {
+
+		if sm.buffer.Len() > 0 && sm.buffer.Len()+1+len(line) > sm.options.MTU {
+			packets = sm.take(packets)
+		}
+		if sm.buffer.Len() > 0 {
+			sm.buffer.WriteByte('\n')
+		}
+		sm.buffer.WriteString(line)
+		sm.lines++
+	}
+	sm.mutex.Unlock()
+
+	err := sm.send(packets)
+	if err != nil {
+		sm.logger.Error(err)
+	}
+}
+
+func (sm *StatsdMeter) export() error {
+
+	sm.mutex.Lock()
+	packets := sm.take(nil)
+	sm.mutex.Unlock()
+
+	return sm.send(packets)
+}
+
+// Flush sends what is collected since the previous flush
+func (sm *StatsdMeter) Flush(ctx context.Context) error {
+	return waitContext(ctx, sm.export)
+}
+
+func (sm *StatsdMeter) sample(m *statsdMetric, value float64, kind string) {
+
+	rate := sm.options.SampleRate
+	if rate <= 0 || rate >= 1 {
+		sm.write(fmt.Sprintf("%s:%s|%s%s", m.name, statsdFormat(value), kind, m.suffix))
+		return
+	}
+
+	if rand.Float64() >= rate {
+		return
+	}
+	sm.write(fmt.Sprintf("%s:%s|%s|@%s%s", m.name, statsdFormat(value), kind, statsdFormat(rate), m.suffix))
+}
+
+func (smc *StatsdCounter) Inc() common.Counter {
+
+	return smc.Add(1)
+}
+
+func (smc *StatsdCounter) Add(value int) common.Counter {
+
+	smc.meter.sample(&smc.statsdMetric, float64(value), "c")
+	return smc
+}
+
+// AddWithSpan adds value only, as statsd has no exemplars
+func (smc *StatsdCounter) AddWithSpan(value int, span common.TracerSpanContext) common.Counter {
+
+	return smc.Add(value)
+}
+
+func (sm *StatsdMeter) Counter(group, name, description string, labels common.Labels, prefixes ...string) common.Counter {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return nil
+	}
+	return &StatsdCounter{statsdMetric: *m}
+}
+
+func (smfc *StatsdFloatCounter) Add(value float64) common.FloatCounter {
+
+	smfc.meter.sample(&smfc.statsdMetric, value, "c")
+	return smfc
+}
+
+func (sm *StatsdMeter) FloatCounter(group, name, description string, labels common.Labels, prefixes ...string) common.FloatCounter {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return nil
+	}
+	return &StatsdFloatCounter{statsdMetric: *m}
+}
+
+// send sends absolute value, negative one is preceded by zero as a sign means relative change
+func (smg *StatsdGauge) send(value float64) common.Gauge {
+
+	line := fmt.Sprintf("%s:%s|g%s", smg.name, statsdFormat(value), smg.suffix)
+	if value < 0 {
+		smg.meter.write(fmt.Sprintf("%s:0|g%s", smg.name, smg.suffix), line)
+		return smg
+	}
+	smg.meter.write(line)
+	return smg
+}
+
+func (smg *StatsdGauge) Set(value float64) common.Gauge {
+
+	return smg.send(smg.value.Set(value))
+}
+
+func (smg *StatsdGauge) Add(value float64) common.Gauge {
+
+	return smg.send(smg.value.Add(value))
+}
+
+func (smg *StatsdGauge) Sub(value float64) common.Gauge {
+
+	return smg.send(smg.value.Add(-value))
+}
+
+func (smg *StatsdGauge) Inc() common.Gauge {
+
+	return smg.Add(1)
+}
+
+func (smg *StatsdGauge) Dec() common.Gauge {
+
+	return smg.Sub(1)
+}
+
+func (sm *StatsdMeter) Gauge(group, name, description string, labels common.Labels, prefixes ...string) common.Gauge {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return nil
+	}
+
+	// gauge keeps its value, so the same name and tags share it
+	key := m.name + m.suffix
+	if _, ok := sm.observables.Load(key); ok {
+		sm.logger.Error(fmt.Errorf("statsd gauge %s is observable, it can't be set", key))
+		return nil
+	}
+	g, _ := sm.gauges.LoadOrStore(key, &StatsdGauge{statsdMetric: *m})
+	return g.(*StatsdGauge)
+}
+
+// ObservableGauge keeps callback of the first registration, series of gauge which is set can't be observed
+func (sm *StatsdMeter) ObservableGauge(group, name, description string, labels common.Labels, callback func() float64, prefixes ...string) {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return
+	}
+
+	key := m.name + m.suffix
+	if _, ok := sm.gauges.Load(key); ok {
+		sm.logger.Error(fmt.Errorf("statsd gauge %s is set, it can't be observable", key))
+		return
+	}
+	if _, loaded := sm.observables.LoadOrStore(key, true); loaded {
+		return
+	}
+
+	gauge := &StatsdGauge{statsdMetric: *m}
+	sm.observer.Observe(func() {
+		gauge.Set(callback())
+	})
+}
+
+func (smh *StatsdHistogram) Observe(value float64) common.Histogram {
+
+	smh.meter.sample(&smh.statsdMetric, value, "ms")
+	return smh
+}
+
+// ObserveWithSpan observes value only, as statsd has no exemplars
+func (smh *StatsdHistogram) ObserveWithSpan(value float64, span common.TracerSpanContext) common.Histogram {
+
+	return smh.Observe(value)
+}
+
+// Histogram is sent as timer, its percentiles and buckets are calculated by statsd server
+func (sm *StatsdMeter) Histogram(group, name, description string, labels common.Labels, prefixes ...string) common.Histogram {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return nil
+	}
+	return &StatsdHistogram{statsdMetric: *m}
+}
+
+func (sm *StatsdMeter) HistogramWithBuckets(group, name, description string, labels common.Labels, buckets []float64, prefixes ...string) common.Histogram {
+
+	return sm.Histogram(group, name, description, labels, prefixes...)
+}
+
+func (sms *StatsdSummary) Observe(value float64) common.Summary {
+
+	sms.meter.sample(&sms.statsdMetric, value, "ms")
+	return sms
+}
+
+func (sm *StatsdMeter) Summary(group, name, description string, labels common.Labels, quantiles []float64, window time.Duration, prefixes ...string) common.Summary {
+
+	m, err := sm.build(name, description, labels, prefixes...)
+	if err != nil {
+		sm.logger.Error(err)
+		return nil
+	}
+	return &StatsdSummary{statsdMetric: *m}
+}
+
+func (sm *StatsdMeter) Group(name string) common.Group {
+
+	return nil
+}
+
+func (sm *StatsdMeter) flush() {
+
+	defer sm.wg.Done()
+
+	ticker := time.NewTicker(sm.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.stop:
+			return
+		case <-ticker.C:
+			if err := sm.export(); err != nil {
+				sm.logger.Error(err)
+			}
+		}
+	}
+}
+
+func (sm *StatsdMeter) Stop() {
+
+	err := sm.Shutdown(context.Background())
+	if err != nil {
+		sm.logger.Error(err)
+	}
+}
+
+// Shutdown stops flushing by interval and sends the rest of lines
+func (sm *StatsdMeter) Shutdown(ctx context.Context) error {
+
+	return waitContext(ctx, func() error {
+
+		var err error
+		sm.once.Do(func() {
+			sm.observer.Stop()
+			close(sm.stop)
+			sm.wg.Wait()
+			err = errors.Join(sm.export(), sm.conn.Close())
+		})
+		return err
+	})
+}
+
+func NewStatsdMeter(options StatsdOptions, logger common.Logger, stdout *Stdout) *StatsdMeter {
+
+	if logger == nil {
+		logger = stdout
+	}
+
+	if utils.IsEmpty(options.Host) {
+		stdout.Debug("Statsd meter is disabled.")
+		return nil
+	}
+
+	if utils.IsEmpty(options.Dialect) {
+		options.Dialect = StatsdDialectNone
+	}
+	switch options.Dialect {
+	case StatsdDialectNone, StatsdDialectDogStatsD, StatsdDialectInfluxDB, StatsdDialectGraphite:
+	default:
+		logger.Error("Statsd dialect %s is not supported", options.Dialect)
+		return nil
+	}
+
+	if options.MTU <= 0 {
+		options.MTU = StatsdDefaultMTU
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = StatsdDefaultFlushInterval
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(options.Host, strconv.Itoa(options.Port)))
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	sm := &StatsdMeter{
+		options:     options,
+		logger:      logger,
+		conn:        conn,
+		gauges:      &sync.Map{},
+		observables: &sync.Map{},
+		observer:    NewMeterObserver(MeterObserverDefaultInterval),
+		stop:        make(chan struct{}),
+	}
+
+	sm.wg.Add(1)
+	go sm.flush()
+
+	logger.Info("Statsd meter is up...")
+	return sm
+}
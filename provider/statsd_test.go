@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopsext/sre/common"
+)
+
+func statsdNewMeter(t *testing.T, options StatsdOptions) (*StatsdMeter, net.PacketConn) {
+
+	stdout := NewStdout(StdoutOptions{
+		Format:          "template",
+		Level:           "debug",
+		Template:        "{{.msg}}",
+		TimestampFormat: time.RFC3339Nano,
+	})
+	if stdout == nil {
+		t.Fatal("Invalid stdout")
+	}
+	stdout.SetCallerOffset(1)
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options.Host = "127.0.0.1"
+	options.Port = server.LocalAddr().(*net.UDPAddr).Port
+
+	statsd := NewStatsdMeter(options, nil, stdout)
+	if statsd == nil {
+		t.Fatal("Invalid statsd")
+	}
+	return statsd, server
+}
+
+func statsdReadPackets(t *testing.T, server net.PacketConn) []string {
+
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		server.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+	return packets
+}
+
+func TestStatsdMeterDialects(t *testing.T) {
+
+	expected := map[string]string{
+		StatsdDialectNone:      "test.requests:2|c",
+		StatsdDialectDogStatsD: "test.requests:2|c|#env:dev,code:200,path:a_b",
+		StatsdDialectInfluxDB:  "test.requests,env=dev,code=200,path=a_b:2|c",
+		StatsdDialectGraphite:  "test.requests;env=dev;code=200;path=a_b:2|c",
+	}
+
+	for dialect, line := range expected {
+
+		statsd, server := statsdNewMeter(t, StatsdOptions{
+			Prefix:  "test",
+			Tags:    "env=dev",
+			Dialect: dialect,
+		})
+
+		labels := common.Labels{"code": "200", "path": "a:b"}
+		statsd.Counter("", "requests", "Requests", labels).Add(2)
+		statsd.Stop()
+
+		packets := statsdReadPackets(t, server)
+		server.Close()
+
+		if len(packets) != 1 || packets[0] != line {
+			t.Fatalf("Wrong %s packets: %v", dialect, packets)
+		}
+	}
+}
+
+func TestStatsdMeterBatching(t *testing.T) {
+
+	statsd, server := statsdNewMeter(t, StatsdOptions{
+		Prefix: "test",
+		MTU:    64,
+	})
+	defer server.Close()
+
+	gauge := statsd.Gauge("", "load", "Load", nil)
+	gauge.Set(5).Sub(7)
+	statsd.Histogram("", "latency", "Latency", nil).Observe(1.5)
+	statsd.FloatCounter("", "bytes", "Bytes", nil).Add(0.5)
+	statsd.Summary("", "size", "Size", nil, nil, time.Minute).Observe(3)
+	statsd.Stop()
+
+	packets := statsdReadPackets(t, server)
+
+	var lines []string
+	for _, p := range packets {
+		if len(p) > 64 {
+			t.Fatalf("Packet exceeds MTU: %q", p)
+		}
+		lines = append(lines, strings.Split(p, "\n")...)
+	}
+
+	expected := []string{"test.load:5|g", "test.load:0|g", "test.load:-2|g", "test.latency:1.5|ms", "test.bytes:0.5|c", "test.size:3|ms"}
+	if strings.Join(lines, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Wrong lines: %v", lines)
+	}
+	if len(packets) < 2 {
+		t.Fatalf("Lines are not batched by MTU: %v", packets)
+	}
+}
+
+func TestStatsdMeterObservableGauge(t *testing.T) {
+
+	statsd, server := statsdNewMeter(t, StatsdOptions{Prefix: "test"})
+	defer server.Close()
+
+	// observable gauge can't be set, gauge which is set can't get callback
+	statsd.ObservableGauge("", "observed", "description", nil, func() float64 { return 42 })
+	if statsd.Gauge("", "observed", "description", nil) != nil {
+		t.Fatal("Observable gauge is returned as gauge")
+	}
+	statsd.Gauge("", "inflight", "description", nil).Set(1)
+	statsd.ObservableGauge("", "inflight", "description", nil, func() float64 { return 42 })
+	if statsd.Gauge("", "inflight", "description", nil) == nil {
+		t.Fatal("Gauge is observable")
+	}
+
+	statsd.Stop()
+}
+
+func TestStatsdMeterSampleRate(t *testing.T) {
+
+	statsd, server := statsdNewMeter(t, StatsdOptions{
+		Prefix:     "test",
+		SampleRate: 0.5,
+	})
+	defer server.Close()
+
+	counter := statsd.Counter("", "sampled", "Sampled", nil)
+	for i := 0; i < 100; i++ {
+		counter.Inc()
+	}
+	statsd.Stop()
+
+	var lines []string
+	for _, p := range statsdReadPackets(t, server) {
+		lines = append(lines, strings.Split(p, "\n")...)
+	}
+
+	if len(lines) == 0 || len(lines) == 100 {
+		t.Fatalf("Wrong number of sampled lines: %d", len(lines))
+	}
+	for _, l := range lines {
+		if l != "test.sampled:1|c|@0.5" {
+			t.Fatalf("Wrong sampled line: %s", l)
+		}
+	}
+}
+
+func TestStatsdMeterWrongOptions(t *testing.T) {
+
+	stdout := NewStdout(StdoutOptions{Format: "template", Level: "debug", Template: "{{.msg}}"})
+
+	if NewStatsdMeter(StatsdOptions{}, nil, stdout) != nil {
+		t.Fatal("Valid statsd")
+	}
+	if NewStatsdMeter(StatsdOptions{Host: "127.0.0.1", Port: 8125, Dialect: "unknown"}, nil, stdout) != nil {
+		t.Fatal("Valid statsd with unknown dialect")
+	}
+}
+
+func TestStatsdMeterTelemetry(t *testing.T) {
+
+	statsd, server := statsdNewMeter(t, StatsdOptions{
+		Prefix: "test",
+	})
+	defer server.Close()
+
+	common.SetTelemetry(common.NewTelemetry(statsd))
+	defer common.SetTelemetry(nil)
+
+	statsd.Counter("", "requests", "Requests", nil).Inc()
+	if err := statsd.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	statsd.Stop()
+
+	packets := strings.Join(statsdReadPackets(t, server), "\n")
+	if !strings.Contains(packets, "test.requests:1|c") || !strings.Contains(packets, "test.telemetry.records_sent:1|c") {
+		t.Fatalf("Wrong packets with telemetry: %s", packets)
+	}
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"text/template"
@@ -217,6 +218,32 @@ func (so *Stdout) Stop() {
 	//
 }
 
+func (so *Stdout) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (so *Stdout) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func logLevel(level string) logrus.Level {
+
+	switch level {
+	case "info":
+		return logrus.InfoLevel
+	case "error":
+		return logrus.ErrorLevel
+	case "panic":
+		return logrus.PanicLevel
+	case "warn":
+		return logrus.WarnLevel
+	case "debug":
+		return logrus.DebugLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
 func newLog(options StdoutOptions) *logrus.Logger {
 
 	log := logrus.New()
@@ -251,21 +278,7 @@ func newLog(options StdoutOptions) *logrus.Logger {
 		log.SetFormatter(formatter)
 	}
 
-	switch options.Level {
-	case "info":
-		log.SetLevel(logrus.InfoLevel)
-	case "error":
-		log.SetLevel(logrus.ErrorLevel)
-	case "panic":
-		log.SetLevel(logrus.PanicLevel)
-	case "warn":
-		log.SetLevel(logrus.WarnLevel)
-	case "debug":
-		log.SetLevel(logrus.DebugLevel)
-	default:
-		log.SetLevel(logrus.InfoLevel)
-	}
-
+	log.SetLevel(logLevel(options.Level))
 	log.SetOutput(os.Stdout)
 	return log
 }